@@ -0,0 +1,184 @@
+package Netpbm
+
+import (
+	"fmt"
+	"image"
+)
+
+// Anchor tells ResizeCanvas where to keep the image on the new canvas.
+type Anchor int
+
+// Anchor positions, row by row from the top-left corner.
+const (
+	AnchorTopLeft Anchor = iota
+	AnchorTop
+	AnchorTopRight
+	AnchorLeft
+	AnchorCenter
+	AnchorRight
+	AnchorBottomLeft
+	AnchorBottom
+	AnchorBottomRight
+)
+
+// offset returns where the top-left corner of an image of size (w, h) lands
+// on a canvas of size (width, height) for the anchor. It is negative on the
+// axes where the canvas is smaller than the image.
+func (a Anchor) offset(w, h, width, height int) (dx, dy int, err error) {
+	if a < AnchorTopLeft || a > AnchorBottomRight {
+		return 0, 0, fmt.Errorf("netpbm: invalid anchor %d", a)
+	}
+	col, row := int(a)%3, int(a)/3
+	return (width - w) * col / 2, (height - h) * row / 2, nil
+}
+
+// copyShifted copies the pixels of an image of size (sw, sh) onto an image of
+// size (dw, dh), with its top-left corner at (dx, dy). Pixels falling outside
+// the destination are dropped. n is the number of samples per pixel.
+func copyShifted[T any](dst func(y int) []T, dw, dh int, src func(y int) []T, sw, sh int, dx, dy, n int) {
+	x0, x1 := max(dx, 0), min(dx+sw, dw)
+	y0, y1 := max(dy, 0), min(dy+sh, dh)
+	for y := y0; y < y1; y++ {
+		copy(dst(y)[x0*n:x1*n], src(y - dy)[(x0-dx)*n:(x1-dx)*n])
+	}
+}
+
+// cropRect clips r to bounds and returns an error wrapping ErrOutOfBounds if nothing is left.
+func cropRect(r, bounds image.Rectangle) (image.Rectangle, error) {
+	clipped := r.Intersect(bounds)
+	if clipped.Empty() {
+		return clipped, fmt.Errorf("%w: crop rectangle %v does not overlap %v", ErrOutOfBounds, r, bounds)
+	}
+	return clipped, nil
+}
+
+// checkPadding returns an error if any padding is negative.
+func checkPadding(top, right, bottom, left int) error {
+	if top < 0 || right < 0 || bottom < 0 || left < 0 {
+		return fmt.Errorf("netpbm: negative padding (%d, %d, %d, %d)", top, right, bottom, left)
+	}
+	return nil
+}
+
+// reframe replaces the image with a width x height canvas filled with fill,
+// with the old image copied at (dx, dy).
+func (pbm *PBM) reframe(width, height, dx, dy int, fill bool) error {
+	canvas, err := NewPBM(width, height, pbm.magicNumber, fill)
+	if err != nil {
+		return err
+	}
+	copyShifted(canvas.row, width, height, pbm.row, pbm.width, pbm.height, dx, dy, 1)
+	*pbm = *canvas
+	return nil
+}
+
+// Crop cuts the image down to the part inside r, which is clipped to the
+// bounds of the image. The pixel at r.Min becomes the pixel at (0, 0).
+func (pbm *PBM) Crop(r image.Rectangle) error {
+	r, err := cropRect(r, pbm.Bounds())
+	if err != nil {
+		return err
+	}
+	return pbm.reframe(r.Dx(), r.Dy(), -r.Min.X, -r.Min.Y, false)
+}
+
+// Pad adds borders of the given widths around the image, filled with fill (true is black).
+func (pbm *PBM) Pad(top, right, bottom, left int, fill bool) error {
+	if err := checkPadding(top, right, bottom, left); err != nil {
+		return err
+	}
+	return pbm.reframe(pbm.width+left+right, pbm.height+top+bottom, left, top, fill)
+}
+
+// ResizeCanvas changes the size of the image without scaling it. The image is
+// placed on the new canvas according to anchor; parts that no longer fit are
+// cut off and new areas are filled with fill (true is black).
+func (pbm *PBM) ResizeCanvas(width, height int, anchor Anchor, fill bool) error {
+	dx, dy, err := anchor.offset(pbm.width, pbm.height, width, height)
+	if err != nil {
+		return err
+	}
+	return pbm.reframe(width, height, dx, dy, fill)
+}
+
+// reframe replaces the image with a width x height canvas filled with fill,
+// with the old image copied at (dx, dy).
+func (pgm *PGM) reframe(width, height, dx, dy int, fill uint16) error {
+	canvas, err := NewPGM(width, height, pgm.magicNumber, pgm.max, fill)
+	if err != nil {
+		return err
+	}
+	copyShifted(canvas.row, width, height, pgm.row, pgm.width, pgm.height, dx, dy, 1)
+	*pgm = *canvas
+	return nil
+}
+
+// Crop cuts the image down to the part inside r, which is clipped to the
+// bounds of the image. The pixel at r.Min becomes the pixel at (0, 0).
+func (pgm *PGM) Crop(r image.Rectangle) error {
+	r, err := cropRect(r, pgm.Bounds())
+	if err != nil {
+		return err
+	}
+	return pgm.reframe(r.Dx(), r.Dy(), -r.Min.X, -r.Min.Y, 0)
+}
+
+// Pad adds borders of the given widths around the image, filled with the gray level fill.
+func (pgm *PGM) Pad(top, right, bottom, left int, fill uint16) error {
+	if err := checkPadding(top, right, bottom, left); err != nil {
+		return err
+	}
+	return pgm.reframe(pgm.width+left+right, pgm.height+top+bottom, left, top, fill)
+}
+
+// ResizeCanvas changes the size of the image without scaling it. The image is
+// placed on the new canvas according to anchor; parts that no longer fit are
+// cut off and new areas are filled with the gray level fill.
+func (pgm *PGM) ResizeCanvas(width, height int, anchor Anchor, fill uint16) error {
+	dx, dy, err := anchor.offset(pgm.width, pgm.height, width, height)
+	if err != nil {
+		return err
+	}
+	return pgm.reframe(width, height, dx, dy, fill)
+}
+
+// reframe replaces the image with a width x height canvas filled with fill,
+// with the old image copied at (dx, dy).
+func (ppm *PPM) reframe(width, height, dx, dy int, fill Pixel) error {
+	canvas, err := NewPPM(width, height, ppm.magicNumber, ppm.max, fill)
+	if err != nil {
+		return err
+	}
+	copyShifted(canvas.row, width, height, ppm.row, ppm.width, ppm.height, dx, dy, 3)
+	*ppm = *canvas
+	return nil
+}
+
+// Crop cuts the image down to the part inside r, which is clipped to the
+// bounds of the image. The pixel at r.Min becomes the pixel at (0, 0).
+func (ppm *PPM) Crop(r image.Rectangle) error {
+	r, err := cropRect(r, ppm.Bounds())
+	if err != nil {
+		return err
+	}
+	return ppm.reframe(r.Dx(), r.Dy(), -r.Min.X, -r.Min.Y, Pixel{})
+}
+
+// Pad adds borders of the given widths around the image, filled with the color fill.
+func (ppm *PPM) Pad(top, right, bottom, left int, fill Pixel) error {
+	if err := checkPadding(top, right, bottom, left); err != nil {
+		return err
+	}
+	return ppm.reframe(ppm.width+left+right, ppm.height+top+bottom, left, top, fill)
+}
+
+// ResizeCanvas changes the size of the image without scaling it. The image is
+// placed on the new canvas according to anchor; parts that no longer fit are
+// cut off and new areas are filled with the color fill.
+func (ppm *PPM) ResizeCanvas(width, height int, anchor Anchor, fill Pixel) error {
+	dx, dy, err := anchor.offset(ppm.width, ppm.height, width, height)
+	if err != nil {
+		return err
+	}
+	return ppm.reframe(width, height, dx, dy, fill)
+}
@@ -0,0 +1,118 @@
+package Netpbm
+
+import (
+	"image/color"
+	"math"
+)
+
+// ColorizeOptions controls the conversions from PBM and PGM to formats with
+// more levels. A nil *ColorizeOptions keeps black and white.
+type ColorizeOptions struct {
+	// MaxValue is the maximum value of the result. Zero means 255 when
+	// converting a PBM image, and the maximum value of the source when
+	// converting a PGM image.
+	MaxValue uint16
+	// Foreground is the color of black PBM pixels, or of gray level 0. Nil means black.
+	Foreground color.Color
+	// Background is the color of white PBM pixels, or of the maximum gray level. Nil means white.
+	Background color.Color
+}
+
+// maxValueFor returns the maximum value of the result, def if none was given.
+func (o *ColorizeOptions) maxValueFor(def uint16) uint16 {
+	if o == nil || o.MaxValue == 0 {
+		return def
+	}
+	return o.MaxValue
+}
+
+// colors returns the foreground and background as red, green and blue samples scaled to max.
+func (o *ColorizeOptions) colors(max uint16) (fg, bg [3]uint16) {
+	var foreground, background color.Color = color.Black, color.White
+	if o != nil && o.Foreground != nil {
+		foreground = o.Foreground
+	}
+	if o != nil && o.Background != nil {
+		background = o.Background
+	}
+	scale := func(c color.Color) [3]uint16 {
+		r, g, b, _ := c.RGBA()
+		return [3]uint16{scaleSample(uint16(r), 0xffff, max), scaleSample(uint16(g), 0xffff, max), scaleSample(uint16(b), 0xffff, max)}
+	}
+	return scale(foreground), scale(background)
+}
+
+// grays returns the foreground and background as gray levels scaled to max.
+func (o *ColorizeOptions) grays(max uint16) (fg, bg uint16) {
+	var foreground, background color.Color = color.Black, color.White
+	if o != nil && o.Foreground != nil {
+		foreground = o.Foreground
+	}
+	if o != nil && o.Background != nil {
+		background = o.Background
+	}
+	gray := func(c color.Color) uint16 {
+		return scaleSample(color.Gray16Model.Convert(c).(color.Gray16).Y, 0xffff, max)
+	}
+	return gray(foreground), gray(background)
+}
+
+// ToPGM converts the PBM image to a P2 PGM image, black pixels taking the
+// gray level of the foreground and white pixels that of the background.
+func (pbm *PBM) ToPGM(opts *ColorizeOptions) *PGM {
+	max := opts.maxValueFor(255)
+	fg, bg := opts.grays(max)
+
+	pgm := newPGM(pbm.width, pbm.height, "P2", max)
+	for y := 0; y < pbm.height; y++ {
+		row := pgm.row(y)
+		for x, pixel := range pbm.row(y) {
+			row[x] = bg
+			if pixel != 0 {
+				row[x] = fg
+			}
+		}
+	}
+	return pgm
+}
+
+// ToPPM converts the PBM image to a P3 PPM image, black pixels taking the
+// foreground color and white pixels the background color.
+func (pbm *PBM) ToPPM(opts *ColorizeOptions) *PPM {
+	max := opts.maxValueFor(255)
+	fg, bg := opts.colors(max)
+
+	ppm := newPPM(pbm.width, pbm.height, "P3", max)
+	for y := 0; y < pbm.height; y++ {
+		row := ppm.row(y)
+		for x, pixel := range pbm.row(y) {
+			c := &bg
+			if pixel != 0 {
+				c = &fg
+			}
+			copy(row[3*x:3*x+3], c[:])
+		}
+	}
+	return ppm
+}
+
+// ToPPM converts the PGM image to a P3 PPM image. Gray levels are mapped
+// linearly from the foreground color, for 0, to the background color, for
+// the maximum value. With the default black and white and the same maximum
+// value the conversion is lossless.
+func (pgm *PGM) ToPPM(opts *ColorizeOptions) *PPM {
+	max := opts.maxValueFor(pgm.max)
+	fg, bg := opts.colors(max)
+
+	ppm := newPPM(pgm.width, pgm.height, "P3", max)
+	for y := 0; y < pgm.height; y++ {
+		row := ppm.row(y)
+		for x, v := range pgm.row(y) {
+			t := float64(v) / float64(pgm.max)
+			for c := 0; c < 3; c++ {
+				row[3*x+c] = uint16(math.Round(float64(fg[c]) + (float64(bg[c])-float64(fg[c]))*t))
+			}
+		}
+	}
+	return ppm
+}
@@ -0,0 +1,54 @@
+package Netpbm
+
+import (
+	"image/color"
+	"slices"
+	"testing"
+)
+
+func TestPBMToPGMAndPPM(t *testing.T) {
+	pbm, _ := NewPBM(2, 1, "P1")
+	pbm.SetBit(0, 0, true)
+
+	pgm := pbm.ToPGM(nil)
+	if pgm.MaxValue() != 255 || !slices.Equal(pgm.Pix(), []uint16{0, 255}) {
+		t.Errorf("ToPGM(nil) = %v with maximum %d, want [0 255] with maximum 255", pgm.Pix(), pgm.MaxValue())
+	}
+	pgm = pbm.ToPGM(&ColorizeOptions{MaxValue: 1000, Foreground: color.Gray{51}, Background: color.Gray{204}})
+	if !slices.Equal(pgm.Pix(), []uint16{200, 800}) {
+		t.Errorf("ToPGM with grays = %v, want [200 800]", pgm.Pix())
+	}
+
+	ppm := pbm.ToPPM(nil)
+	if !slices.Equal(ppm.Pix(), []uint16{0, 0, 0, 255, 255, 255}) {
+		t.Errorf("ToPPM(nil) = %v, want black then white", ppm.Pix())
+	}
+	ppm = pbm.ToPPM(&ColorizeOptions{Foreground: color.RGBA{0, 0, 255, 255}, Background: color.RGBA{255, 255, 0, 255}})
+	if !slices.Equal(ppm.Pix(), []uint16{0, 0, 255, 255, 255, 0}) {
+		t.Errorf("ToPPM with colors = %v, want blue then yellow", ppm.Pix())
+	}
+}
+
+func TestPGMToPPM(t *testing.T) {
+	// With the defaults, converting back with ToPGM is lossless
+	for _, max := range []uint16{1, 255, 1000, 65535} {
+		pgm := patternPGM(t, 9, 7, max)
+		ppm := pgm.ToPPM(nil)
+		if ppm.MaxValue() != max {
+			t.Errorf("max %d: ToPPM maximum value = %d", max, ppm.MaxValue())
+		}
+		back := ppm.ToPGM()
+		back.SetMagicNumber(pgm.MagicNumber())
+		if !back.Equal(pgm) {
+			t.Errorf("max %d: ToPPM(nil).ToPGM() = %v, want %v", max, back.Pix(), pgm.Pix())
+		}
+	}
+
+	// Gray levels run from the foreground to the background
+	pgm, _ := NewPGM(3, 1, "P2", 4)
+	copy(pgm.Pix(), []uint16{0, 2, 4})
+	ppm := pgm.ToPPM(&ColorizeOptions{MaxValue: 255, Foreground: color.RGBA{0, 0, 255, 255}, Background: color.RGBA{255, 0, 0, 255}})
+	if want := []uint16{0, 0, 255, 128, 0, 128, 255, 0, 0}; !slices.Equal(ppm.Pix(), want) {
+		t.Errorf("ToPPM from blue to red = %v, want %v", ppm.Pix(), want)
+	}
+}
@@ -0,0 +1,189 @@
+package Netpbm
+
+// Dither selects how gray levels are turned into black and white pixels.
+type Dither int
+
+const (
+	// Threshold makes pixels at or below half the maximum value black, and the others white.
+	Threshold Dither = iota
+	// FloydSteinberg diffuses the error to 4 neighbors.
+	FloydSteinberg
+	// Atkinson diffuses 3/4 of the error to 6 neighbors, which keeps more contrast.
+	Atkinson
+	// JarvisJudiceNinke diffuses the error to 12 neighbors over 3 rows.
+	JarvisJudiceNinke
+	// Stucki diffuses the error to 12 neighbors over 3 rows, with sharper weights than JarvisJudiceNinke.
+	Stucki
+	// Sierra diffuses the error to 10 neighbors over 3 rows.
+	Sierra
+	// Bayer2, Bayer4, Bayer8 and Bayer16 compare each pixel against an ordered
+	// threshold matrix of that size, which gives a regular cross-hatch pattern.
+	Bayer2
+	Bayer4
+	Bayer8
+	Bayer16
+)
+
+// DitherOptions controls ToPBM.
+type DitherOptions struct {
+	// Method is the dithering algorithm. The zero value thresholds at half the
+	// maximum value, and so does any value that is not one of the Dither
+	// constants, since ToPBM cannot report an error.
+	Method Dither
+	// Serpentine scans every other row from right to left, which breaks up the
+	// directional artifacts of error diffusion. Ordered dithering ignores it.
+	Serpentine bool
+	// Gray selects how PPM.ToPBM turns colors into gray levels before
+	// dithering. Gray images ignore it.
+	Gray GrayOptions
+}
+
+// diffusionTap passes the share weight/divisor of the error of a pixel to
+// the pixel dx columns ahead and dy rows below.
+type diffusionTap struct {
+	dx, dy, weight int
+}
+
+// diffusion is an error diffusion kernel.
+type diffusion struct {
+	divisor float64
+	taps    []diffusionTap
+}
+
+var diffusionKernels = map[Dither]diffusion{
+	FloydSteinberg: {16, []diffusionTap{
+		{1, 0, 7},
+		{-1, 1, 3}, {0, 1, 5}, {1, 1, 1},
+	}},
+	Atkinson: {8, []diffusionTap{
+		{1, 0, 1}, {2, 0, 1},
+		{-1, 1, 1}, {0, 1, 1}, {1, 1, 1},
+		{0, 2, 1},
+	}},
+	JarvisJudiceNinke: {48, []diffusionTap{
+		{1, 0, 7}, {2, 0, 5},
+		{-2, 1, 3}, {-1, 1, 5}, {0, 1, 7}, {1, 1, 5}, {2, 1, 3},
+		{-2, 2, 1}, {-1, 2, 3}, {0, 2, 5}, {1, 2, 3}, {2, 2, 1},
+	}},
+	Stucki: {42, []diffusionTap{
+		{1, 0, 8}, {2, 0, 4},
+		{-2, 1, 2}, {-1, 1, 4}, {0, 1, 8}, {1, 1, 4}, {2, 1, 2},
+		{-2, 2, 1}, {-1, 2, 2}, {0, 2, 4}, {1, 2, 2}, {2, 2, 1},
+	}},
+	Sierra: {32, []diffusionTap{
+		{1, 0, 5}, {2, 0, 3},
+		{-2, 1, 2}, {-1, 1, 4}, {0, 1, 5}, {1, 1, 4}, {2, 1, 2},
+		{-1, 2, 2}, {0, 2, 3}, {1, 2, 2},
+	}},
+}
+
+// bayerMatrix returns the n x n Bayer index matrix, n being a power of two,
+// holding each value from 0 to n*n-1 once.
+func bayerMatrix(n int) [][]int {
+	m := [][]int{{0}}
+	for size := 1; size < n; size *= 2 {
+		next := make([][]int, 2*size)
+		for y := range next {
+			next[y] = make([]int, 2*size)
+			for x := range next[y] {
+				// Each quadrant repeats the smaller matrix, offset by 0, 2, 3 and 1
+				offset := [2][2]int{{0, 2}, {3, 1}}[y/size][x/size]
+				next[y][x] = 4*m[y%size][x%size] + offset
+			}
+		}
+		m = next
+	}
+	return m
+}
+
+// bayerSize returns the size of the matrix used by an ordered dither, or 0 for other methods.
+func (d Dither) bayerSize() int {
+	switch d {
+	case Bayer2:
+		return 2
+	case Bayer4:
+		return 4
+	case Bayer8:
+		return 8
+	case Bayer16:
+		return 16
+	}
+	return 0
+}
+
+// dither converts the gray levels of pgm to a black and white image.
+func (pgm *PGM) dither(opts DitherOptions) *PBM {
+	pbm := newPBM(pgm.width, pgm.height, "P1")
+	white := float64(pgm.max)
+
+	if n := opts.Method.bayerSize(); n != 0 {
+		m := bayerMatrix(n)
+		for y := 0; y < pgm.height; y++ {
+			row := pbm.row(y)
+			for x, v := range pgm.row(y) {
+				// Thresholds are spread evenly over (0, max)
+				if float64(v) < (float64(m[y%n][x%n])+0.5)/float64(n*n)*white {
+					row[x] = 1
+				}
+			}
+		}
+		return pbm
+	}
+
+	// Threshold, and unknown methods, use a fixed threshold
+	kernel, ok := diffusionKernels[opts.Method]
+	if !ok {
+		for y := 0; y < pgm.height; y++ {
+			row := pbm.row(y)
+			for x, v := range pgm.row(y) {
+				if v <= pgm.max/2 {
+					row[x] = 1
+				}
+			}
+		}
+		return pbm
+	}
+
+	// Keep one row of accumulated error per row the kernel reaches
+	rows := 1
+	for _, t := range kernel.taps {
+		rows = max(rows, t.dy+1)
+	}
+	errs := make([][]float64, rows)
+	for i := range errs {
+		errs[i] = make([]float64, pgm.width)
+	}
+
+	for y := 0; y < pgm.height; y++ {
+		x0, x1, step := 0, pgm.width, 1
+		if opts.Serpentine && y%2 == 1 {
+			x0, x1, step = pgm.width-1, -1, -1
+		}
+		src, dst := pgm.row(y), pbm.row(y)
+		for x := x0; x != x1; x += step {
+			v := float64(src[x]) + errs[0][x]
+			out := white
+			if v <= white/2 {
+				out = 0
+				dst[x] = 1
+			}
+			e := (v - out) / kernel.divisor
+			for _, t := range kernel.taps {
+				// Mirror the kernel when scanning right to left
+				tx := x + t.dx*step
+				if tx >= 0 && tx < pgm.width {
+					errs[t.dy][tx] += e * float64(t.weight)
+				}
+			}
+		}
+
+		// Shift the error rows up, recycling the current one
+		first := errs[0]
+		copy(errs, errs[1:])
+		for i := range first {
+			first[i] = 0
+		}
+		errs[rows-1] = first
+	}
+	return pbm
+}
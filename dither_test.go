@@ -0,0 +1,115 @@
+package Netpbm
+
+import (
+	"slices"
+	"testing"
+)
+
+var ditherMethods = []struct {
+	name   string
+	method Dither
+}{
+	{"Threshold", Threshold},
+	{"FloydSteinberg", FloydSteinberg},
+	{"Atkinson", Atkinson},
+	{"JarvisJudiceNinke", JarvisJudiceNinke},
+	{"Stucki", Stucki},
+	{"Sierra", Sierra},
+	{"Bayer2", Bayer2},
+	{"Bayer4", Bayer4},
+	{"Bayer8", Bayer8},
+	{"Bayer16", Bayer16},
+}
+
+// blackFraction returns the share of black pixels of the image.
+func blackFraction(pbm *PBM) float64 {
+	black := 0
+	for _, v := range pbm.Pix() {
+		black += int(v)
+	}
+	return float64(black) / float64(len(pbm.Pix()))
+}
+
+func TestToPBMPolarity(t *testing.T) {
+	// Dark pixels become black, up to and including half the maximum value
+	pgm, _ := NewPGM(4, 1, "P2", 255)
+	copy(pgm.Pix(), []uint16{0, 127, 128, 255})
+	want := []uint8{1, 1, 0, 0}
+	if got := pgm.ToPBM().Pix(); !slices.Equal(got, want) {
+		t.Errorf("PGM.ToPBM = %v, want %v", got, want)
+	}
+
+	ppm, _ := NewPPM(4, 1, "P3", 255)
+	for x, v := range []uint16{0, 127, 128, 255} {
+		ppm.SetPixel(x, 0, Pixel{v, v, v})
+	}
+	if got := ppm.ToPBM().Pix(); !slices.Equal(got, want) {
+		t.Errorf("PPM.ToPBM = %v, want %v", got, want)
+	}
+	if got := ppm.ToPAM().ToPBM().Pix(); !slices.Equal(got, want) {
+		t.Errorf("PAM.ToPBM = %v, want %v", got, want)
+	}
+
+	// Every method keeps black black and white white
+	for _, m := range ditherMethods {
+		black, _ := NewPGM(8, 8, "P2", 255)
+		if f := blackFraction(black.ToPBM(DitherOptions{Method: m.method})); f != 1 {
+			t.Errorf("%s: black image is %v black, want 1", m.name, f)
+		}
+		white, _ := NewPGM(8, 8, "P2", 255, 255)
+		if f := blackFraction(white.ToPBM(DitherOptions{Method: m.method})); f != 0 {
+			t.Errorf("%s: white image is %v black, want 0", m.name, f)
+		}
+	}
+}
+
+func TestDitherMidGray(t *testing.T) {
+	for _, m := range ditherMethods[1:] {
+		for _, serpentine := range []bool{false, true} {
+			pgm, _ := NewPGM(64, 64, "P2", 255, 128)
+			got := blackFraction(pgm.ToPBM(DitherOptions{Method: m.method, Serpentine: serpentine}))
+			if got < 0.47 || got > 0.53 {
+				t.Errorf("%s (serpentine %v): mid gray is %.3f black, want about 0.5", m.name, serpentine, got)
+			}
+		}
+	}
+}
+
+func TestDitherUnknownMethod(t *testing.T) {
+	pgm, _ := NewPGM(2, 1, "P2", 255)
+	copy(pgm.Pix(), []uint16{100, 200})
+	if got, want := pgm.ToPBM(DitherOptions{Method: -1}).Pix(), []uint8{1, 0}; !slices.Equal(got, want) {
+		t.Errorf("ToPBM = %v, want %v", got, want)
+	}
+}
+
+func TestDitherGray(t *testing.T) {
+	// Pure red is dark by luma and bright by the red channel alone
+	ppm, _ := NewPPM(1, 1, "P3", 255)
+	ppm.SetPixel(0, 0, Pixel{255, 0, 0})
+	if !ppm.ToPBM(DitherOptions{Gray: GrayOptions{Method: GrayRec601}}).BitAt(0, 0) {
+		t.Error("red is white with GrayRec601, want black")
+	}
+	if ppm.ToPBM(DitherOptions{Gray: GrayOptions{Method: GrayRed}}).BitAt(0, 0) {
+		t.Error("red is black with GrayRed, want white")
+	}
+}
+
+func TestBayerMatrix(t *testing.T) {
+	for _, n := range []int{1, 2, 4, 8, 16} {
+		m := bayerMatrix(n)
+		var values []int
+		for _, row := range m {
+			values = append(values, row...)
+		}
+		slices.Sort(values)
+		for i, v := range values {
+			if v != i {
+				t.Fatalf("bayerMatrix(%d) holds %v, want each of 0 to %d once", n, values, n*n-1)
+			}
+		}
+	}
+	if got, want := bayerMatrix(2), [][]int{{0, 2}, {3, 1}}; !slices.EqualFunc(got, want, slices.Equal[[]int]) {
+		t.Errorf("bayerMatrix(2) = %v, want %v", got, want)
+	}
+}
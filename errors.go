@@ -0,0 +1,49 @@
+package Netpbm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors returned, usually wrapped in a *ParseError, by the readers
+// and writers of this package. Test for them with errors.Is.
+var (
+	// ErrBadMagic means the magic number is missing, unknown, or not valid for the requested format.
+	ErrBadMagic = errors.New("netpbm: bad magic number")
+	// ErrTruncated means the data ended before the header or raster was complete.
+	ErrTruncated = errors.New("netpbm: truncated image data")
+	// ErrInvalidHeader means a header field is malformed or out of range.
+	ErrInvalidHeader = errors.New("netpbm: invalid header")
+	// ErrInvalidMaxValue means the maximum value is outside 1 to 65535.
+	ErrInvalidMaxValue = errors.New("netpbm: invalid maximum value")
+	// ErrInvalidSample means a raster sample is malformed or exceeds the maximum value.
+	ErrInvalidSample = errors.New("netpbm: invalid sample")
+	// ErrOutOfBounds means pixel coordinates lie outside the image.
+	ErrOutOfBounds = errors.New("netpbm: coordinates out of bounds")
+	// ErrSingularMatrix means a transformation matrix cannot be inverted.
+	ErrSingularMatrix = errors.New("netpbm: singular transformation matrix")
+)
+
+// ParseError records where decoding a netpbm stream failed.
+type ParseError struct {
+	// Offset is the byte offset in the stream of the offending token, or of
+	// the point where the data ran out.
+	Offset int64
+	// Line is the 1-based line number matching Offset.
+	// Raw rasters contain no lines, so inside them it stays at the line the header ended on.
+	Line int
+	// Msg describes the problem.
+	Msg string
+	// Err is the sentinel error classifying the problem, such as ErrTruncated.
+	Err error
+}
+
+// Error returns the error message, including its position.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v: %s (line %d, offset %d)", e.Err, e.Msg, e.Line, e.Offset)
+}
+
+// Unwrap returns the sentinel error, so that errors.Is(err, ErrTruncated) works.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
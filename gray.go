@@ -0,0 +1,104 @@
+package Netpbm
+
+import "math"
+
+// GrayMethod selects how PPM.ToPGM turns colors into gray levels.
+type GrayMethod int
+
+const (
+	// GrayAverage gives the same weight to red, green and blue.
+	GrayAverage GrayMethod = iota
+	// GrayRec601 uses the Rec. 601 luma weights 0.299, 0.587 and 0.114, as
+	// color.GrayModel and JPEG do.
+	GrayRec601
+	// GrayRec709 uses the Rec. 709 luma weights 0.2126, 0.7152 and 0.0722 on
+	// the gamma-encoded samples.
+	GrayRec709
+	// GrayLinear decodes the sRGB gamma, weighs the linear-light components with
+	// the Rec. 709 weights and encodes the resulting luminance back with the sRGB
+	// gamma, so that the gray level looks as bright as the color.
+	GrayLinear
+	// GrayRed, GrayGreen and GrayBlue keep a single channel.
+	GrayRed
+	GrayGreen
+	GrayBlue
+	// GrayCustom uses Weights. Weights that add up to 1 keep the range of the image.
+	GrayCustom
+)
+
+// GrayOptions controls PPM.ToPGM.
+type GrayOptions struct {
+	// Method is the conversion to gray. The zero value averages the components.
+	Method GrayMethod
+	// Weights are the red, green and blue weights used by GrayCustom.
+	Weights [3]float64
+}
+
+// weights returns the red, green and blue weights of the method, or false
+// for GrayLinear, which does not weigh the samples directly.
+func (o GrayOptions) weights() ([3]float64, bool) {
+	switch o.Method {
+	case GrayRec601:
+		return [3]float64{0.299, 0.587, 0.114}, true
+	case GrayRec709:
+		return [3]float64{0.2126, 0.7152, 0.0722}, true
+	case GrayLinear:
+		return [3]float64{}, false
+	case GrayRed:
+		return [3]float64{1, 0, 0}, true
+	case GrayGreen:
+		return [3]float64{0, 1, 0}, true
+	case GrayBlue:
+		return [3]float64{0, 0, 1}, true
+	case GrayCustom:
+		return o.Weights, true
+	}
+	return [3]float64{1.0 / 3, 1.0 / 3, 1.0 / 3}, true
+}
+
+// srgbToLinear decodes an sRGB-encoded value from 0 to 1.
+func srgbToLinear(c float64) float64 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return math.Pow((c+0.055)/1.055, 2.4)
+}
+
+// linearToSRGB encodes a linear-light value from 0 to 1 with the sRGB gamma.
+func linearToSRGB(c float64) float64 {
+	if c <= 0.0031308 {
+		return 12.92 * c
+	}
+	return 1.055*math.Pow(c, 1/2.4) - 0.055
+}
+
+// grayFunc returns the function converting red, green and blue samples from
+// 0 to max into a gray level from 0 to max, rounded and clamped.
+func (o GrayOptions) grayFunc(max uint16) func(r, g, b uint16) uint16 {
+	clamp := func(v float64) uint16 {
+		return uint16(math.Min(math.Max(v+0.5, 0), float64(max)))
+	}
+
+	if o.Method == GrayAverage {
+		// Truncated integer average, as ToPGM always computed it
+		return func(r, g, b uint16) uint16 {
+			return uint16((uint32(r) + uint32(g) + uint32(b)) / 3)
+		}
+	}
+
+	if w, ok := o.weights(); ok {
+		return func(r, g, b uint16) uint16 {
+			return clamp(w[0]*float64(r) + w[1]*float64(g) + w[2]*float64(b))
+		}
+	}
+
+	// Decode every possible sample once
+	linear := make([]float64, int(max)+1)
+	for v := range linear {
+		linear[v] = srgbToLinear(float64(v) / float64(max))
+	}
+	return func(r, g, b uint16) uint16 {
+		y := 0.2126*linear[r] + 0.7152*linear[g] + 0.0722*linear[b]
+		return clamp(linearToSRGB(y) * float64(max))
+	}
+}
@@ -0,0 +1,50 @@
+package Netpbm
+
+import "testing"
+
+func TestToPGMWeights(t *testing.T) {
+	primaries := []Pixel{{255, 0, 0}, {0, 255, 0}, {0, 0, 255}, {255, 255, 255}, {0, 0, 0}}
+	tests := []struct {
+		name string
+		opts GrayOptions
+		// want holds the gray levels of red, green, blue, white and black.
+		want []uint16
+	}{
+		{"average", GrayOptions{}, []uint16{85, 85, 85, 255, 0}},
+		{"Rec601", GrayOptions{Method: GrayRec601}, []uint16{76, 150, 29, 255, 0}},
+		{"Rec709", GrayOptions{Method: GrayRec709}, []uint16{54, 182, 18, 255, 0}},
+		// The linear luminances 0.2126, 0.7152 and 0.0722 encoded with the sRGB gamma
+		{"linear", GrayOptions{Method: GrayLinear}, []uint16{127, 220, 76, 255, 0}},
+		{"red", GrayOptions{Method: GrayRed}, []uint16{255, 0, 0, 255, 0}},
+		{"green", GrayOptions{Method: GrayGreen}, []uint16{0, 255, 0, 255, 0}},
+		{"blue", GrayOptions{Method: GrayBlue}, []uint16{0, 0, 255, 255, 0}},
+		{"custom", GrayOptions{Method: GrayCustom, Weights: [3]float64{0.5, 0.5, 0}}, []uint16{128, 128, 0, 255, 0}},
+		{"custom clamped", GrayOptions{Method: GrayCustom, Weights: [3]float64{2, -1, 0}}, []uint16{255, 0, 0, 255, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ppm, _ := NewPPM(len(primaries), 1, "P3", 255)
+			for x, p := range primaries {
+				ppm.SetPixel(x, 0, p)
+			}
+			pgm := ppm.ToPGM(tt.opts)
+			for x, want := range tt.want {
+				if got := pgm.GrayAt(x, 0); got != want {
+					t.Errorf("gray of %v = %d, want %d", primaries[x], got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestToPGMDeep(t *testing.T) {
+	// 16-bit samples keep their precision
+	ppm, _ := NewPPM(1, 1, "P6", 65535)
+	ppm.SetPixel(0, 0, Pixel{65535, 0, 0})
+	if got := ppm.ToPGM(GrayOptions{Method: GrayRec709}).GrayAt(0, 0); got != 13933 {
+		t.Errorf("Rec709 gray of red = %d, want 13933", got)
+	}
+	if got := ppm.ToPGM(GrayOptions{Method: GrayLinear}).GrayAt(0, 0); got != 32665 {
+		t.Errorf("linear gray of red = %d, want 32665", got)
+	}
+}
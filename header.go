@@ -0,0 +1,292 @@
+package Netpbm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// header holds the fields of a PBM, PGM or PPM header.
+type header struct {
+	magicNumber   string
+	width, height int
+	// max is the maximum sample value, always 1 for PBM images.
+	max int
+}
+
+// tokenReader splits netpbm headers and plain rasters into tokens. As the
+// specification allows, tokens are separated by any amount of whitespace,
+// and a '#' starts a comment that runs to the end of the line, wherever it
+// appears. It tracks its position in the stream for error reporting.
+type tokenReader struct {
+	r *bufio.Reader
+	// offset and line locate the next byte to be read.
+	offset int64
+	line   int
+	// tokenOffset and tokenLine locate the start of the last token.
+	tokenOffset int64
+	tokenLine   int
+	// comment is set when the last token was directly followed by a comment.
+	comment bool
+}
+
+// newTokenReader returns a tokenReader reading from r.
+func newTokenReader(r io.Reader) *tokenReader {
+	return &tokenReader{r: bufio.NewReader(r), line: 1}
+}
+
+// isSpace reports whether c is whitespace in the netpbm sense.
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\v' || c == '\f' || c == '\r'
+}
+
+// errorf returns a *ParseError at the current position.
+func (h *tokenReader) errorf(sentinel error, format string, args ...any) error {
+	return &ParseError{
+		Offset: h.offset,
+		Line:   h.line,
+		Msg:    fmt.Sprintf(format, args...),
+		Err:    sentinel,
+	}
+}
+
+// tokenErrorf returns a *ParseError at the start of the last token.
+func (h *tokenReader) tokenErrorf(sentinel error, format string, args ...any) error {
+	err := h.errorf(sentinel, format, args...).(*ParseError)
+	err.Offset, err.Line = h.tokenOffset, h.tokenLine
+	return err
+}
+
+// readError converts an error from the underlying reader: running out of
+// data becomes an ErrTruncated *ParseError, other errors are returned as is.
+func (h *tokenReader) readError(err error, what string) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return h.errorf(ErrTruncated, "unexpected end of data reading %s", what)
+	}
+	return err
+}
+
+// readByte reads one byte, keeping track of the position.
+func (h *tokenReader) readByte() (byte, error) {
+	c, err := h.r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	h.offset++
+	if c == '\n' {
+		h.line++
+	}
+	return c, nil
+}
+
+// unreadByte puts back the last byte read, which must not be a newline.
+func (h *tokenReader) unreadByte() error {
+	h.offset--
+	return h.r.UnreadByte()
+}
+
+// readFull fills buf with raw raster bytes.
+func (h *tokenReader) readFull(buf []byte) error {
+	n, err := io.ReadFull(h.r, buf)
+	h.offset += int64(n)
+	if err != nil {
+		return h.readError(err, "raster")
+	}
+	return nil
+}
+
+// readLine returns the next line with surrounding whitespace removed.
+// The last line of the stream need not end with a newline.
+func (h *tokenReader) readLine() (string, error) {
+	line, err := h.r.ReadString('\n')
+	h.offset += int64(len(line))
+	if err != nil && (err != io.EOF || line == "") {
+		return "", h.readError(err, "header")
+	}
+	if err == nil {
+		h.line++
+	}
+	return strings.TrimSpace(line), nil
+}
+
+// skipComment discards bytes up to and including the next newline.
+func (h *tokenReader) skipComment() error {
+	for {
+		c, err := h.readByte()
+		if err != nil {
+			return err
+		}
+		if c == '\n' {
+			return nil
+		}
+	}
+}
+
+// token returns the next token. The single whitespace character that ends
+// the token is consumed; a comment that ends it is left in the reader.
+func (h *tokenReader) token(what string) (string, error) {
+	h.comment = false
+
+	// Skip whitespace and comments before the token
+	var c byte
+	var err error
+	for {
+		c, err = h.readByte()
+		if err != nil {
+			return "", h.readError(err, what)
+		}
+		if c == '#' {
+			if err := h.skipComment(); err != nil {
+				return "", h.readError(err, what)
+			}
+			continue
+		}
+		if !isSpace(c) {
+			break
+		}
+	}
+
+	// Read the token itself
+	h.tokenOffset, h.tokenLine = h.offset-1, h.line
+	tok := []byte{c}
+	for {
+		c, err = h.readByte()
+		if err == io.EOF {
+			return string(tok), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if isSpace(c) {
+			return string(tok), nil
+		}
+		if c == '#' {
+			h.comment = true
+			return string(tok), h.unreadByte()
+		}
+		tok = append(tok, c)
+	}
+}
+
+// int reads the next token as a non-negative decimal integer.
+func (h *tokenReader) int(what string) (int, error) {
+	tok, err := h.token(what)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(tok)
+	if err != nil || n < 0 {
+		return 0, h.tokenErrorf(ErrInvalidHeader, "invalid %s %q", what, tok)
+	}
+	return n, nil
+}
+
+// sample reads the next plain (P2, P3) raster sample, which may not exceed max.
+func (h *tokenReader) sample(max int) (uint16, error) {
+	tok, err := h.token("raster")
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(tok)
+	if err != nil || n < 0 {
+		return 0, h.tokenErrorf(ErrInvalidSample, "invalid sample %q", tok)
+	}
+	if n > max {
+		return 0, h.tokenErrorf(ErrInvalidSample, "sample %d exceeds maximum value %d", n, max)
+	}
+	return uint16(n), nil
+}
+
+// bit reads the next plain (P1) raster pixel. Pixels are single '0' or '1'
+// characters and need not be separated by whitespace, so "0101" holds four
+// pixels.
+func (h *tokenReader) bit() (bool, error) {
+	for {
+		c, err := h.readByte()
+		if err != nil {
+			return false, h.readError(err, "raster")
+		}
+		switch {
+		case c == '0':
+			return false, nil
+		case c == '1':
+			return true, nil
+		case c == '#':
+			if err := h.skipComment(); err != nil {
+				return false, h.readError(err, "raster")
+			}
+		case !isSpace(c):
+			h.tokenOffset, h.tokenLine = h.offset-1, h.line
+			return false, h.tokenErrorf(ErrInvalidSample, "invalid pixel %q", c)
+		}
+	}
+}
+
+// endHeader positions the reader at the first byte of the raster. This only
+// matters when the last header token was directly followed by a comment.
+func (h *tokenReader) endHeader() error {
+	if !h.comment {
+		return nil
+	}
+	if err := h.skipComment(); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
+
+// readHeader reads the magic number, dimensions and, except for PBM images,
+// the maximum value, leaving the reader at the start of the raster. The
+// magic number must be one of magicNumbers.
+func (h *tokenReader) readHeader(magicNumbers ...string) (header, error) {
+	var hdr header
+
+	magicNumber, err := h.token("magic number")
+	if err != nil {
+		if errors.Is(err, ErrTruncated) {
+			return hdr, h.errorf(ErrBadMagic, "missing magic number")
+		}
+		return hdr, err
+	}
+	if !slices.Contains(magicNumbers, magicNumber) {
+		return hdr, h.tokenErrorf(ErrBadMagic, "got %q, want one of %v", magicNumber, magicNumbers)
+	}
+	hdr.magicNumber = magicNumber
+
+	if hdr.width, err = h.int("width"); err != nil {
+		return hdr, err
+	}
+	if hdr.height, err = h.int("height"); err != nil {
+		return hdr, err
+	}
+	samples := 1
+	if magicNumber == "P3" || magicNumber == "P6" {
+		samples = 3
+	}
+	if msg := dimensionsProblem(hdr.width, hdr.height, samples); msg != "" {
+		return hdr, h.tokenErrorf(ErrInvalidHeader, "%s", msg)
+	}
+
+	if magicNumber == "P1" || magicNumber == "P4" {
+		hdr.max = 1
+	} else {
+		tok, err := h.token("maximum value")
+		if err != nil {
+			return hdr, err
+		}
+		if hdr.max, err = strconv.Atoi(tok); err != nil || hdr.max < 1 || hdr.max > 65535 {
+			return hdr, h.tokenErrorf(ErrInvalidMaxValue, "invalid maximum value %q", tok)
+		}
+	}
+
+	logger().Debug("netpbm: parsed header",
+		"magicNumber", hdr.magicNumber, "width", hdr.width, "height", hdr.height, "max", hdr.max,
+		"offset", h.offset, "line", h.line)
+	if h.comment {
+		logger().Debug("netpbm: comment directly after header, raster starts on the next line")
+	}
+	return hdr, h.endHeader()
+}
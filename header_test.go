@@ -0,0 +1,121 @@
+package Netpbm
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestReadHeader(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  header
+		// next is the first raster byte, read after the header.
+		next byte
+	}{
+		{"one line", "P5 3 2 255\nx", header{"P5", 3, 2, 255}, 'x'},
+		{"one token per line", "P2\n3\n2\n255\nx", header{"P2", 3, 2, 255}, 'x'},
+		{"tabs and carriage returns", "P2\t3\r\n2 \t255\r", header{"P2", 3, 2, 255}, 0},
+		{"comment lines", "# first\nP2\n# size\n3 2\n# max\n255\nx", header{"P2", 3, 2, 255}, 'x'},
+		{"comment ends a token", "P2 3#width\n2 255\nx", header{"P2", 3, 2, 255}, 'x'},
+		{"comment ends the magic number", "P2#magic\n3 2 255\nx", header{"P2", 3, 2, 255}, 'x'},
+		{"comment right after maxval", "P5 3 2 255#max\nx", header{"P5", 3, 2, 255}, 'x'},
+		{"comment right after height", "P4 3 2#size\nx", header{"P4", 3, 2, 1}, 'x'},
+		{"raster starting with whitespace", "P5 3 2 255\n\n", header{"P5", 3, 2, 255}, '\n'},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTokenReader(strings.NewReader(tt.input))
+			hdr, err := h.readHeader("P2", "P4", "P5")
+			if err != nil {
+				t.Fatalf("readHeader: %v", err)
+			}
+			if hdr != tt.want {
+				t.Errorf("readHeader = %+v, want %+v", hdr, tt.want)
+			}
+			if tt.next != 0 {
+				if c, err := h.readByte(); err != nil || c != tt.next {
+					t.Errorf("first raster byte = %q, %v, want %q", c, err, tt.next)
+				}
+			}
+		})
+	}
+}
+
+func TestHeaderErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  error
+	}{
+		{"empty", "", ErrBadMagic},
+		{"unknown magic number", "P9 1 1 255\n", ErrBadMagic},
+		{"missing height", "P2 3", ErrTruncated},
+		{"missing maxval", "P2 3 2\n", ErrTruncated},
+		{"negative width", "P2 -3 2 255\n", ErrInvalidHeader},
+		{"non-numeric height", "P2 3 x 255\n", ErrInvalidHeader},
+		{"zero width", "P2 0 2 255\n", ErrInvalidHeader},
+		{"zero size", "P5 0 0 255\n", ErrInvalidHeader},
+		{"overflowing size", "P5 4294967296 4294967296 255\n", ErrInvalidHeader},
+		{"overflowing width", "P6 99999999999999999999 1 255\n", ErrInvalidHeader},
+		{"zero maxval", "P2 3 2 0\n", ErrInvalidMaxValue},
+		{"maxval above 65535", "P2 3 2 65536\n", ErrInvalidMaxValue},
+		{"huge image without data", "P6 50000 50000 255\n", ErrTruncated},
+		{"PAM without ENDHDR", "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 1\nMAXVAL 255\n", ErrTruncated},
+		{"PAM unknown field", "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 1\nMAXVAL 255\nCOLOR 1\nENDHDR\n", ErrInvalidHeader},
+		{"PAM zero width", "P7\nWIDTH 0\nHEIGHT 1\nDEPTH 1\nMAXVAL 255\nENDHDR\n", ErrInvalidHeader},
+		{"PAM missing depth", "P7\nWIDTH 1\nHEIGHT 1\nMAXVAL 255\nENDHDR\n", ErrInvalidHeader},
+		{"PAM zero maxval", "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 1\nMAXVAL 0\nENDHDR\n", ErrInvalidMaxValue},
+		{"PAM RGB too shallow", "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 1\nMAXVAL 255\nTUPLTYPE RGB\nENDHDR\n\x00", ErrInvalidHeader},
+		{"PAM alpha too shallow", "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 1\nMAXVAL 255\nTUPLTYPE GRAYSCALE_ALPHA\nENDHDR\n\x00", ErrInvalidHeader},
+		{"PAM black and white maxval", "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 1\nMAXVAL 255\nTUPLTYPE BLACKANDWHITE\nENDHDR\n\x00", ErrInvalidHeader},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(strings.NewReader(tt.input))
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Decode error = %v, want %v", err, tt.want)
+			}
+			var perr *ParseError
+			if tt.input != "" && !errors.As(err, &perr) {
+				t.Errorf("Decode error %v is not a *ParseError", err)
+			}
+		})
+	}
+}
+
+func TestParseErrorPosition(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		want   error
+		line   int
+		offset int64
+	}{
+		// The position is where the data ran out
+		{"truncated header", "P2\n3", ErrTruncated, 2, 4},
+		{"truncated plain raster", "P2\n2 2\n255\n1 2\n3", ErrTruncated, 5, 16},
+		{"truncated raw raster", "P5\n2 2\n255\n\x01\x02\x03", ErrTruncated, 4, 14},
+		// The position is the start of the offending token
+		{"bad width", "P2\n# size\n3x 2\n255\n", ErrInvalidHeader, 3, 10},
+		{"bad maxval", "P2 3 2\n  70000\n", ErrInvalidMaxValue, 2, 9},
+		{"sample above maxval", "P2 2 1 15\n1\n16\n", ErrInvalidSample, 3, 12},
+		{"bad pixel", "P1 2 1\n0 2\n", ErrInvalidSample, 2, 9},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(strings.NewReader(tt.input))
+			var perr *ParseError
+			if !errors.As(err, &perr) {
+				t.Fatalf("Decode error = %v, want a *ParseError", err)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Decode error = %v, want %v", err, tt.want)
+			}
+			if perr.Line != tt.line || perr.Offset != tt.offset {
+				t.Errorf("error at line %d, offset %d, want line %d, offset %d", perr.Line, perr.Offset, tt.line, tt.offset)
+			}
+		})
+	}
+}
@@ -0,0 +1,309 @@
+package Netpbm
+
+import (
+	"image"
+	"image/color"
+	"io"
+	"strings"
+)
+
+// Register the netpbm formats with the standard image package, so that
+// image.Decode and image.DecodeConfig recognize them.
+func init() {
+	image.RegisterFormat("pbm", "P1", decodeImage, decodeConfig)
+	image.RegisterFormat("pbm", "P4", decodeImage, decodeConfig)
+	image.RegisterFormat("pgm", "P2", decodeImage, decodeConfig)
+	image.RegisterFormat("pgm", "P5", decodeImage, decodeConfig)
+	image.RegisterFormat("ppm", "P3", decodeImage, decodeConfig)
+	image.RegisterFormat("ppm", "P6", decodeImage, decodeConfig)
+	image.RegisterFormat("pam", "P7", decodeImage, decodeConfig)
+}
+
+// bitmapPalette is the color model of PBM images: index 0 is white, 1 is black.
+var bitmapPalette = color.Palette{color.White, color.Black}
+
+// scaleSample rescales v from the range 0 to max to the range 0 to newMax, rounding.
+func scaleSample(v, max, newMax uint16) uint16 {
+	return uint16((uint32(v)*uint32(newMax) + uint32(max)/2) / uint32(max))
+}
+
+// grayModel returns the color model for grayscale samples of the given maximum value.
+func grayModel(max uint16) color.Model {
+	if max > 255 {
+		return color.Gray16Model
+	}
+	return color.GrayModel
+}
+
+// rgbModel returns the color model for color samples of the given maximum
+// value, with or without a non-premultiplied alpha channel.
+func rgbModel(max uint16, alpha bool) color.Model {
+	switch {
+	case max > 255 && alpha:
+		return color.NRGBA64Model
+	case max > 255:
+		return color.RGBA64Model
+	case alpha:
+		return color.NRGBAModel
+	}
+	return color.RGBAModel
+}
+
+// decodeConfig reads only the header of a netpbm image.
+func decodeConfig(r io.Reader) (image.Config, error) {
+	tokens := newTokenReader(r)
+	magic, err := tokens.r.Peek(2)
+	if err != nil {
+		return image.Config{}, tokens.readError(err, "magic number")
+	}
+
+	if string(magic) == "P7" {
+		hdr, err := tokens.readPAMHeader()
+		if err != nil {
+			return image.Config{}, err
+		}
+		alpha := strings.HasSuffix(hdr.tupleType, "_ALPHA")
+		model := grayModel(uint16(hdr.max))
+		if alpha || tupleColorChannels(hdr.tupleType, hdr.depth) == 3 {
+			model = rgbModel(uint16(hdr.max), alpha)
+		}
+		return image.Config{ColorModel: model, Width: hdr.width, Height: hdr.height}, nil
+	}
+
+	hdr, err := tokens.readHeader("P1", "P2", "P3", "P4", "P5", "P6")
+	if err != nil {
+		return image.Config{}, err
+	}
+	var model color.Model
+	switch hdr.magicNumber {
+	case "P1", "P4":
+		model = bitmapPalette
+	case "P2", "P5":
+		model = grayModel(uint16(hdr.max))
+	default:
+		model = rgbModel(uint16(hdr.max), false)
+	}
+	return image.Config{ColorModel: model, Width: hdr.width, Height: hdr.height}, nil
+}
+
+// decodeImage decodes a netpbm image. PAM images are converted into the
+// matching standard library image type, rescaling samples to 8 or 16 bits.
+func decodeImage(r io.Reader) (image.Image, error) {
+	img, err := Decode(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// PBM, PGM and PPM images implement image.Image themselves.
+	if pam, ok := img.(*PAM); ok {
+		return pam.toImage(), nil
+	}
+	return img.(image.Image), nil
+}
+
+// toImage converts the PAM image to an *image.Gray, *image.Gray16,
+// *image.RGBA, *image.RGBA64, *image.NRGBA or *image.NRGBA64, depending on
+// its tuple type and maximum value.
+func (pam *PAM) toImage() image.Image {
+	rect := image.Rect(0, 0, pam.width, pam.height)
+	channels := pam.colorChannels()
+	alpha := pam.HasAlpha()
+
+	// tuple returns the red, green, blue and alpha samples at (x, y), rescaled to newMax.
+	tuple := func(x, y int, newMax uint16) (r, g, b, a uint16) {
+		t := pam.pix[pam.pixOffset(x, y) : pam.pixOffset(x, y)+pam.depth]
+		r = scaleSample(t[0], pam.max, newMax)
+		g, b, a = r, r, newMax
+		if channels == 3 && len(t) >= 3 {
+			g = scaleSample(t[1], pam.max, newMax)
+			b = scaleSample(t[2], pam.max, newMax)
+		}
+		if alpha && len(t) > channels {
+			a = scaleSample(t[len(t)-1], pam.max, newMax)
+		}
+		return r, g, b, a
+	}
+
+	deep := pam.max > 255
+	switch {
+	case channels == 1 && !alpha && !deep:
+		dst := image.NewGray(rect)
+		for y := 0; y < pam.height; y++ {
+			for x := 0; x < pam.width; x++ {
+				v, _, _, _ := tuple(x, y, 0xff)
+				dst.Pix[y*dst.Stride+x] = uint8(v)
+			}
+		}
+		return dst
+	case channels == 1 && !alpha:
+		dst := image.NewGray16(rect)
+		for y := 0; y < pam.height; y++ {
+			for x := 0; x < pam.width; x++ {
+				v, _, _, _ := tuple(x, y, 0xffff)
+				dst.SetGray16(x, y, color.Gray16{v})
+			}
+		}
+		return dst
+	case alpha && !deep:
+		dst := image.NewNRGBA(rect)
+		for y := 0; y < pam.height; y++ {
+			for x := 0; x < pam.width; x++ {
+				r, g, b, a := tuple(x, y, 0xff)
+				dst.SetNRGBA(x, y, color.NRGBA{uint8(r), uint8(g), uint8(b), uint8(a)})
+			}
+		}
+		return dst
+	case alpha:
+		dst := image.NewNRGBA64(rect)
+		for y := 0; y < pam.height; y++ {
+			for x := 0; x < pam.width; x++ {
+				r, g, b, a := tuple(x, y, 0xffff)
+				dst.SetNRGBA64(x, y, color.NRGBA64{r, g, b, a})
+			}
+		}
+		return dst
+	case !deep:
+		dst := image.NewRGBA(rect)
+		for y := 0; y < pam.height; y++ {
+			for x := 0; x < pam.width; x++ {
+				r, g, b, _ := tuple(x, y, 0xff)
+				dst.SetRGBA(x, y, color.RGBA{uint8(r), uint8(g), uint8(b), 0xff})
+			}
+		}
+		return dst
+	}
+	dst := image.NewRGBA64(rect)
+	for y := 0; y < pam.height; y++ {
+		for x := 0; x < pam.width; x++ {
+			r, g, b, _ := tuple(x, y, 0xffff)
+			dst.SetRGBA64(x, y, color.RGBA64{r, g, b, 0xffff})
+		}
+	}
+	return dst
+}
+
+// FromImageOptions controls how PBMFromImage, PGMFromImage and PPMFromImage
+// convert an image.Image. A nil *FromImageOptions uses the defaults.
+type FromImageOptions struct {
+	// MaxValue is the maximum value of a PGM or PPM result. Zero keeps the
+	// maximum value of a *PGM or *PPM source, and otherwise picks 65535 for
+	// sources with a 16-bit color model and 255 for all others.
+	MaxValue uint16
+	// Background is the color that transparent and translucent pixels are
+	// flattened against. Nil means white.
+	Background color.Color
+	// Threshold is the gray level, between 0 and 1, below which PBMFromImage
+	// makes a pixel black. Zero means 0.5.
+	Threshold float64
+}
+
+// maxValueFor returns the maximum value to convert img with.
+func (o *FromImageOptions) maxValueFor(img image.Image) uint16 {
+	if o != nil && o.MaxValue != 0 {
+		return o.MaxValue
+	}
+	switch img := img.(type) {
+	case *PGM:
+		return img.max
+	case *PPM:
+		return img.max
+	}
+	switch img.ColorModel() {
+	case color.Gray16Model, color.RGBA64Model, color.NRGBA64Model, color.Alpha16Model:
+		return 0xffff
+	}
+	return 0xff
+}
+
+// flattener returns a function giving the 16-bit red, green and blue
+// components of a color flattened against the background.
+func (o *FromImageOptions) flattener() func(c color.Color) (r, g, b uint32) {
+	var background color.Color = color.White
+	if o != nil && o.Background != nil {
+		background = o.Background
+	}
+	br, bg, bb, _ := background.RGBA()
+
+	return func(c color.Color) (r, g, b uint32) {
+		// RGBA returns alpha-premultiplied components, so the background
+		// only needs to be added in for the uncovered part.
+		r, g, b, a := c.RGBA()
+		r += br * (0xffff - a) / 0xffff
+		g += bg * (0xffff - a) / 0xffff
+		b += bb * (0xffff - a) / 0xffff
+		return r, g, b
+	}
+}
+
+// luma16 returns the 16-bit gray level of 16-bit red, green and blue
+// components, with the same weights as color.GrayModel.
+func luma16(r, g, b uint32) uint16 {
+	return uint16((19595*r + 38470*g + 7471*b + 1<<15) >> 16)
+}
+
+// PPMFromImage converts any image.Image into a P3 PPM image. The result
+// starts at (0, 0) whatever the bounds of img.
+func PPMFromImage(img image.Image, opts *FromImageOptions) *PPM {
+	bounds := img.Bounds()
+	max := opts.maxValueFor(img)
+	flatten := opts.flattener()
+
+	ppm := newPPM(bounds.Dx(), bounds.Dy(), "P3", max)
+	for i := 0; i < ppm.height; i++ {
+		row := ppm.row(i)
+		for j := 0; j < ppm.width; j++ {
+			r, g, b := flatten(img.At(bounds.Min.X+j, bounds.Min.Y+i))
+			row[3*j] = scaleSample(uint16(r), 0xffff, max)
+			row[3*j+1] = scaleSample(uint16(g), 0xffff, max)
+			row[3*j+2] = scaleSample(uint16(b), 0xffff, max)
+		}
+	}
+
+	return ppm
+}
+
+// PGMFromImage converts any image.Image into a P2 PGM image. Colors are
+// converted to gray as color.GrayModel does. The result starts at (0, 0)
+// whatever the bounds of img.
+func PGMFromImage(img image.Image, opts *FromImageOptions) *PGM {
+	bounds := img.Bounds()
+	max := opts.maxValueFor(img)
+	flatten := opts.flattener()
+
+	pgm := newPGM(bounds.Dx(), bounds.Dy(), "P2", max)
+	for i := 0; i < pgm.height; i++ {
+		row := pgm.row(i)
+		for j := range row {
+			gray := luma16(flatten(img.At(bounds.Min.X+j, bounds.Min.Y+i)))
+			row[j] = scaleSample(gray, 0xffff, max)
+		}
+	}
+
+	return pgm
+}
+
+// PBMFromImage converts any image.Image into a P1 PBM image: pixels whose
+// gray level is below the threshold become black. The result starts at
+// (0, 0) whatever the bounds of img.
+func PBMFromImage(img image.Image, opts *FromImageOptions) *PBM {
+	bounds := img.Bounds()
+	flatten := opts.flattener()
+	threshold := 0.5
+	if opts != nil && opts.Threshold != 0 {
+		threshold = opts.Threshold
+	}
+	cutoff := threshold * 0xffff
+
+	pbm := newPBM(bounds.Dx(), bounds.Dy(), "P1")
+	for i := 0; i < pbm.height; i++ {
+		row := pbm.row(i)
+		for j := range row {
+			gray := luma16(flatten(img.At(bounds.Min.X+j, bounds.Min.Y+i)))
+			if float64(gray) < cutoff {
+				row[j] = 1
+			}
+		}
+	}
+
+	return pbm
+}
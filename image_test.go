@@ -0,0 +1,157 @@
+package Netpbm
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestImageDecode(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		format string
+		// typ is the concrete type image.Decode returns.
+		typ image.Image
+		// model is compared with reflect.DeepEqual, since palettes are slices.
+		model color.Model
+		// at is the color of the pixel at (1, 0).
+		at color.Color
+	}{
+		{"P1", "P1 2 1\n0 1\n", "pbm", (*PBM)(nil), bitmapPalette, color.Black},
+		{"P4", "P4 2 1\n\x40", "pbm", (*PBM)(nil), bitmapPalette, color.Black},
+		{"P2", "P2 2 1 255\n0 200\n", "pgm", (*PGM)(nil), color.GrayModel, color.Gray{200}},
+		{"P5 16-bit", "P5 2 1 1000\n\x00\x00\x03\xe8", "pgm", (*PGM)(nil), color.Gray16Model, color.Gray16{0xffff}},
+		{"P3", "P3 2 1 15\n0 0 0 15 0 5\n", "ppm", (*PPM)(nil), color.RGBAModel, color.RGBA{255, 0, 85, 255}},
+		{"P6 16-bit", "P6 2 1 65535\n\x00\x00\x00\x00\x00\x00\xff\xff\x00\x01\x80\x00", "ppm", (*PPM)(nil), color.RGBA64Model, color.RGBA64{0xffff, 1, 0x8000, 0xffff}},
+		{"P7 grayscale", "P7\nWIDTH 2\nHEIGHT 1\nDEPTH 1\nMAXVAL 255\nTUPLTYPE GRAYSCALE\nENDHDR\n\x00\x80", "pam",
+			(*image.Gray)(nil), color.GrayModel, color.Gray{0x80}},
+		{"P7 black and white", "P7\nWIDTH 2\nHEIGHT 1\nDEPTH 1\nMAXVAL 1\nTUPLTYPE BLACKANDWHITE\nENDHDR\n\x00\x01", "pam",
+			(*image.Gray)(nil), color.GrayModel, color.Gray{0xff}},
+		{"P7 grayscale 16-bit", "P7\nWIDTH 2\nHEIGHT 1\nDEPTH 1\nMAXVAL 65535\nTUPLTYPE GRAYSCALE\nENDHDR\n\x00\x00\x12\x34", "pam",
+			(*image.Gray16)(nil), color.Gray16Model, color.Gray16{0x1234}},
+		{"P7 grayscale alpha", "P7\nWIDTH 2\nHEIGHT 1\nDEPTH 2\nMAXVAL 255\nTUPLTYPE GRAYSCALE_ALPHA\nENDHDR\n\x00\x00\x80\x40", "pam",
+			(*image.NRGBA)(nil), color.NRGBAModel, color.NRGBA{0x80, 0x80, 0x80, 0x40}},
+		{"P7 RGB", "P7\nWIDTH 2\nHEIGHT 1\nDEPTH 3\nMAXVAL 255\nTUPLTYPE RGB\nENDHDR\n\x00\x00\x00\x10\x20\x30", "pam",
+			(*image.RGBA)(nil), color.RGBAModel, color.RGBA{0x10, 0x20, 0x30, 0xff}},
+		{"P7 RGB 16-bit", "P7\nWIDTH 2\nHEIGHT 1\nDEPTH 3\nMAXVAL 4095\nTUPLTYPE RGB\nENDHDR\n\x00\x00\x00\x00\x00\x00\x0f\xff\x00\x00\x08\x00", "pam",
+			(*image.RGBA64)(nil), color.RGBA64Model, color.RGBA64{0xffff, 0, 0x8008, 0xffff}},
+		{"P7 RGB alpha", "P7\nWIDTH 2\nHEIGHT 1\nDEPTH 4\nMAXVAL 255\nTUPLTYPE RGB_ALPHA\nENDHDR\n\x00\x00\x00\x00\xff\x00\x00\x80", "pam",
+			(*image.NRGBA)(nil), color.NRGBAModel, color.NRGBA{0xff, 0, 0, 0x80}},
+		{"P7 RGB alpha 16-bit", "P7\nWIDTH 2\nHEIGHT 1\nDEPTH 4\nMAXVAL 65535\nTUPLTYPE RGB_ALPHA\nENDHDR\n\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x00\x02\x00\x03\x00\x04", "pam",
+			(*image.NRGBA64)(nil), color.NRGBA64Model, color.NRGBA64{1, 2, 3, 4}},
+		{"P7 unknown tuple type", "P7\nWIDTH 2\nHEIGHT 1\nDEPTH 3\nMAXVAL 255\nTUPLTYPE YCBCR\nENDHDR\n\x00\x00\x00\x01\x02\x03", "pam",
+			(*image.RGBA)(nil), color.RGBAModel, color.RGBA{1, 2, 3, 0xff}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, format, err := image.Decode(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("image.Decode: %v", err)
+			}
+			if format != tt.format {
+				t.Errorf("format = %q, want %q", format, tt.format)
+			}
+			if reflect.TypeOf(img) != reflect.TypeOf(tt.typ) {
+				t.Errorf("image.Decode returned %T, want %T", img, tt.typ)
+			}
+			if !reflect.DeepEqual(img.ColorModel(), tt.model) {
+				t.Errorf("ColorModel = %v, want %v", img.ColorModel(), tt.model)
+			}
+			if img.Bounds() != image.Rect(0, 0, 2, 1) {
+				t.Errorf("Bounds = %v, want 2x1", img.Bounds())
+			}
+			if got := img.At(1, 0); got != tt.at {
+				t.Errorf("At(1, 0) = %#v, want %#v", got, tt.at)
+			}
+
+			config, format, err := image.DecodeConfig(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("image.DecodeConfig: %v", err)
+			}
+			if format != tt.format || config.Width != 2 || config.Height != 1 {
+				t.Errorf("DecodeConfig = %q %dx%d, want %q 2x1", format, config.Width, config.Height, tt.format)
+			}
+			if !reflect.DeepEqual(config.ColorModel, img.ColorModel()) {
+				t.Errorf("DecodeConfig color model = %v, image color model = %v", config.ColorModel, img.ColorModel())
+			}
+		})
+	}
+}
+
+func TestImageDraw(t *testing.T) {
+	// Drawing scales 16-bit colors to the maximum value of the destination
+	pgm, _ := NewPGM(2, 1, "P2", 1000)
+	draw.Draw(pgm, image.Rect(0, 0, 1, 1), image.NewUniform(color.Gray{128}), image.Point{}, draw.Src)
+	draw.Draw(pgm, image.Rect(1, 0, 2, 1), image.White, image.Point{}, draw.Src)
+	if want := []uint16{502, 1000}; !slices.Equal(pgm.Pix(), want) {
+		t.Errorf("PGM with maximum 1000 = %v, want %v", pgm.Pix(), want)
+	}
+	if got := pgm.At(1, 0); got != (color.Gray16{0xffff}) {
+		t.Errorf("PGM At(1, 0) = %#v, want white", got)
+	}
+
+	ppm, _ := NewPPM(2, 1, "P3", 15)
+	draw.Draw(ppm, image.Rect(0, 0, 1, 1), image.NewUniform(color.RGBA{255, 0, 0, 255}), image.Point{}, draw.Src)
+	draw.Draw(ppm, image.Rect(1, 0, 2, 1), image.NewUniform(color.RGBA{0, 128, 255, 255}), image.Point{}, draw.Over)
+	if want := []uint16{15, 0, 0, 0, 8, 15}; !slices.Equal(ppm.Pix(), want) {
+		t.Errorf("PPM with maximum 15 = %v, want %v", ppm.Pix(), want)
+	}
+	if got := ppm.At(1, 0); got != (color.RGBA{0, 136, 255, 255}) {
+		t.Errorf("PPM At(1, 0) = %#v, want {0 136 255 255}", got)
+	}
+
+	// Drawing an image onto one with the same maximum value is lossless
+	for _, max := range []uint16{1, 255, 1000, 65535} {
+		src := patternPGM(t, 9, 7, max)
+		dst, _ := NewPGM(9, 7, src.MagicNumber(), max)
+		draw.Draw(dst, dst.Bounds(), src, image.Point{}, draw.Src)
+		if !dst.Equal(src) {
+			t.Errorf("PGM max %d: drawn %v, want %v", max, dst.Pix(), src.Pix())
+		}
+
+		srcPPM := patternPPM(t, 9, 7, max)
+		dstPPM, _ := NewPPM(9, 7, srcPPM.MagicNumber(), max)
+		draw.Draw(dstPPM, dstPPM.Bounds(), srcPPM, image.Point{}, draw.Src)
+		if !dstPPM.Equal(srcPPM) {
+			t.Errorf("PPM max %d: drawn %v, want %v", max, dstPPM.Pix(), srcPPM.Pix())
+		}
+	}
+}
+
+func TestFromImageAlpha(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(3, 5, 6, 6))
+	src.Set(3, 5, color.NRGBA{255, 0, 0, 128})
+	src.Set(4, 5, color.NRGBA{0, 255, 0, 255})
+	// (5, 5) stays fully transparent
+
+	ppm := PPMFromImage(src, nil)
+	if want := []uint16{255, 127, 127, 0, 255, 0, 255, 255, 255}; !slices.Equal(ppm.Pix(), want) {
+		t.Errorf("PPMFromImage over white = %v, want %v", ppm.Pix(), want)
+	}
+	ppm = PPMFromImage(src, &FromImageOptions{Background: color.RGBA{0, 0, 255, 255}})
+	if want := []uint16{128, 0, 127, 0, 255, 0, 0, 0, 255}; !slices.Equal(ppm.Pix(), want) {
+		t.Errorf("PPMFromImage over blue = %v, want %v", ppm.Pix(), want)
+	}
+	ppm = PPMFromImage(src, &FromImageOptions{MaxValue: 1000, Background: color.Black})
+	if want := []uint16{502, 0, 0, 0, 1000, 0, 0, 0, 0}; !slices.Equal(ppm.Pix(), want) {
+		t.Errorf("PPMFromImage over black with maximum 1000 = %v, want %v", ppm.Pix(), want)
+	}
+
+	pgm := PGMFromImage(src, nil)
+	if pgm.MaxValue() != 255 || pgm.GrayAt(2, 0) != 255 {
+		t.Errorf("PGMFromImage: transparent pixel = %d with maximum %d, want white", pgm.GrayAt(2, 0), pgm.MaxValue())
+	}
+	pbm := PBMFromImage(src, nil)
+	if want := []uint8{0, 0, 0}; !slices.Equal(pbm.Pix(), want) {
+		t.Errorf("PBMFromImage over white = %v, want %v", pbm.Pix(), want)
+	}
+	pbm = PBMFromImage(src, &FromImageOptions{Background: color.Black})
+	if want := []uint8{1, 0, 1}; !slices.Equal(pbm.Pix(), want) {
+		t.Errorf("PBMFromImage over black = %v, want %v", pbm.Pix(), want)
+	}
+}
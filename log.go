@@ -0,0 +1,36 @@
+package Netpbm
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+)
+
+// discardHandler is a slog.Handler that drops every record.
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (d discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return d }
+func (d discardHandler) WithGroup(string) slog.Handler           { return d }
+
+var (
+	silentLogger = slog.New(discardHandler{})
+	activeLogger atomic.Pointer[slog.Logger]
+)
+
+// SetLogger sets the logger the package uses to trace its parsing and
+// encoding decisions, at debug level. The package is silent by default;
+// pass nil to make it silent again. It is safe to call concurrently with
+// decoding and encoding.
+func SetLogger(l *slog.Logger) {
+	activeLogger.Store(l)
+}
+
+// logger returns the logger set by SetLogger, or one that discards everything.
+func logger() *slog.Logger {
+	if l := activeLogger.Load(); l != nil {
+		return l
+	}
+	return silentLogger
+}
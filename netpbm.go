@@ -0,0 +1,112 @@
+package Netpbm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"os"
+)
+
+// Image is implemented by every netpbm image type of this package:
+// *PBM, *PGM, *PPM and *PAM. Use a type switch to get at the concrete type.
+type Image interface {
+	// Size returns the width and height of the image.
+	Size() (int, int)
+	// MagicNumber returns the format of the image, "P1" to "P7".
+	MagicNumber() string
+	// Save saves the image to a file.
+	Save(filename string) error
+}
+
+// checkDimensions returns an error wrapping ErrInvalidHeader unless width and
+// height are positive and width*height*samples samples fit in memory indexes.
+func checkDimensions(width, height, samples int) error {
+	if msg := dimensionsProblem(width, height, samples); msg != "" {
+		return fmt.Errorf("%w: %s", ErrInvalidHeader, msg)
+	}
+	return nil
+}
+
+// dimensionsProblem describes what checkDimensions rejects about width and
+// height, or returns "" if they are valid.
+func dimensionsProblem(width, height, samples int) string {
+	if width < 1 || height < 1 {
+		return fmt.Sprintf("invalid dimensions %dx%d", width, height)
+	}
+	if width > math.MaxInt/samples/height {
+		return fmt.Sprintf("dimensions %dx%d are too large", width, height)
+	}
+	return ""
+}
+
+// checkSource returns an error if a width x height image has no pixels to
+// sample from, as a SubImage of an empty rectangle does.
+func checkSource(width, height int) error {
+	if width < 1 || height < 1 {
+		return fmt.Errorf("netpbm: source image is empty (%dx%d)", width, height)
+	}
+	return nil
+}
+
+// checkFill returns an error wrapping ErrInvalidSample if more than one fill value is given.
+func checkFill(n int) error {
+	if n > 1 {
+		return fmt.Errorf("%w: got %d fill values, want at most one", ErrInvalidSample, n)
+	}
+	return nil
+}
+
+// ReadAny reads a netpbm image of any format from a file.
+// See Decode for the returned types.
+func ReadAny(filename string) (Image, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Decode(file)
+}
+
+// Decode decodes a netpbm image of any format from r, detecting the format
+// from its magic number. It returns a *PBM for P1 and P4, a *PGM for P2 and
+// P5, a *PPM for P3 and P6, and a *PAM for P7.
+func Decode(r io.Reader) (Image, error) {
+	reader := bufio.NewReader(r)
+	magic, err := reader.Peek(2)
+	if err != nil && len(magic) < 2 {
+		if err != io.EOF {
+			return nil, err
+		}
+		return nil, &ParseError{Line: 1, Msg: "missing magic number", Err: ErrBadMagic}
+	}
+
+	logger().Debug("netpbm: detected format", "magicNumber", string(magic))
+	switch string(magic) {
+	case "P1", "P4":
+		return DecodePBM(reader)
+	case "P2", "P5":
+		return DecodePGM(reader)
+	case "P3", "P6":
+		return DecodePPM(reader)
+	case "P7":
+		return DecodePAM(reader)
+	}
+	return nil, &ParseError{Line: 1, Msg: fmt.Sprintf("unknown magic number %q", magic), Err: ErrBadMagic}
+}
+
+// Encode writes img to w in the format given by its magic number.
+func Encode(w io.Writer, img Image) error {
+	switch img := img.(type) {
+	case *PBM:
+		return EncodePBM(w, img)
+	case *PGM:
+		return EncodePGM(w, img)
+	case *PPM:
+		return EncodePPM(w, img)
+	case *PAM:
+		return EncodePAM(w, img)
+	}
+	return fmt.Errorf("netpbm: unsupported image type %T", img)
+}
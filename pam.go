@@ -0,0 +1,520 @@
+package Netpbm
+
+import (
+	"bufio"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Tuple types defined by the PAM specification.
+const (
+	TupleTypeBlackAndWhite      = "BLACKANDWHITE"
+	TupleTypeGrayscale          = "GRAYSCALE"
+	TupleTypeRGB                = "RGB"
+	TupleTypeBlackAndWhiteAlpha = "BLACKANDWHITE_ALPHA"
+	TupleTypeGrayscaleAlpha     = "GRAYSCALE_ALPHA"
+	TupleTypeRGBAlpha           = "RGB_ALPHA"
+)
+
+// PAM represents a Portable Arbitrary Map image (P7).
+type PAM struct {
+	// pix holds depth samples per pixel, row after row.
+	pix []uint16
+	// stride is the distance in pix between vertically adjacent pixels.
+	stride        int
+	width, height int
+	depth         int
+	max           uint16
+	tupleType     string
+}
+
+// newPAM allocates a PAM image of the given size with all samples set to 0.
+func newPAM(width, height, depth int, max uint16, tupleType string) *PAM {
+	return &PAM{
+		pix:       make([]uint16, width*height*depth),
+		stride:    width * depth,
+		width:     width,
+		height:    height,
+		depth:     depth,
+		max:       max,
+		tupleType: tupleType,
+	}
+}
+
+// ReadPAM reads a PAM image from a file and returns a structure representing the image.
+func ReadPAM(filename string) (*PAM, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return DecodePAM(file)
+}
+
+// DecodePAM decodes a PAM image from r and returns a structure representing the image.
+func DecodePAM(r io.Reader) (*PAM, error) {
+	tokens := newTokenReader(r)
+	hdr, err := tokens.readPAMHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	// Read raw samples, one or two big-endian bytes each, growing the buffer
+	// as they arrive
+	pam := newPAM(hdr.width, 0, hdr.depth, uint16(hdr.max), hdr.tupleType)
+	samples := hdr.width * hdr.height * hdr.depth
+	raw := make([]byte, min(samples, rasterChunk)*bytesPerSample(uint16(hdr.max)))
+	pam.pix, err = readRaster(pam.pix, samples, func(dst []uint16) error {
+		return tokens.readSamples(dst, raw, uint16(hdr.max))
+	})
+	if err != nil {
+		return nil, err
+	}
+	pam.height = hdr.height
+
+	return pam, nil
+}
+
+// pamHeader holds the fields of a PAM header.
+type pamHeader struct {
+	width, height, depth int
+	max                  int
+	tupleType            string
+}
+
+// readPAMHeader reads a PAM header up to and including its ENDHDR line.
+// Unlike the other formats, PAM headers are made of "KEYWORD value" lines.
+func (h *tokenReader) readPAMHeader() (pamHeader, error) {
+	hdr := pamHeader{width: -1, height: -1, depth: -1, max: -1}
+
+	line, err := h.readLine()
+	if err != nil {
+		return hdr, h.errorf(ErrBadMagic, "missing magic number")
+	}
+	if line != "P7" {
+		return hdr, h.errorf(ErrBadMagic, "got %q, want P7", line)
+	}
+
+	// Read header lines up to ENDHDR
+	var tupleTypes []string
+	for {
+		line, err = h.readLine()
+		if err != nil {
+			return hdr, err
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if line == "ENDHDR" {
+			break
+		}
+
+		key, value := line, ""
+		if i := strings.IndexAny(line, " \t"); i >= 0 {
+			key, value = line[:i], strings.TrimSpace(line[i:])
+		}
+		switch key {
+		case "WIDTH":
+			hdr.width, err = strconv.Atoi(value)
+		case "HEIGHT":
+			hdr.height, err = strconv.Atoi(value)
+		case "DEPTH":
+			hdr.depth, err = strconv.Atoi(value)
+		case "MAXVAL":
+			hdr.max, err = strconv.Atoi(value)
+		case "TUPLTYPE":
+			// Multiple TUPLTYPE lines are concatenated with a space
+			tupleTypes = append(tupleTypes, value)
+		default:
+			return hdr, h.errorf(ErrInvalidHeader, "unknown PAM header field %q", key)
+		}
+		if err != nil {
+			return hdr, h.errorf(ErrInvalidHeader, "invalid PAM header line %q", line)
+		}
+	}
+	hdr.tupleType = strings.Join(tupleTypes, " ")
+
+	if hdr.depth < 1 {
+		return hdr, h.errorf(ErrInvalidHeader, "invalid PAM depth %d", hdr.depth)
+	}
+	if msg := dimensionsProblem(hdr.width, hdr.height, hdr.depth); msg != "" {
+		return hdr, h.errorf(ErrInvalidHeader, "%s", msg)
+	}
+	if hdr.max < 1 || hdr.max > 65535 {
+		return hdr, h.errorf(ErrInvalidMaxValue, "invalid maximum value %d", hdr.max)
+	}
+
+	// Known tuple types fix how many samples each tuple needs
+	base := strings.TrimSuffix(hdr.tupleType, "_ALPHA")
+	alpha := base != hdr.tupleType
+	switch base {
+	case TupleTypeBlackAndWhite, TupleTypeGrayscale, TupleTypeRGB:
+		need := tupleColorChannels(base, hdr.depth)
+		if alpha {
+			need++
+		}
+		if hdr.depth < need {
+			return hdr, h.errorf(ErrInvalidHeader, "TUPLTYPE %s needs a depth of at least %d, got %d", hdr.tupleType, need, hdr.depth)
+		}
+		if base == TupleTypeBlackAndWhite && hdr.max != 1 {
+			return hdr, h.errorf(ErrInvalidHeader, "TUPLTYPE %s needs MAXVAL 1, got %d", hdr.tupleType, hdr.max)
+		}
+	default:
+		if alpha && hdr.depth < 2 {
+			return hdr, h.errorf(ErrInvalidHeader, "TUPLTYPE %s needs a depth of at least 2, got %d", hdr.tupleType, hdr.depth)
+		}
+	}
+
+	logger().Debug("netpbm: parsed PAM header",
+		"width", hdr.width, "height", hdr.height, "depth", hdr.depth, "max", hdr.max,
+		"tupleType", hdr.tupleType, "offset", h.offset)
+	return hdr, nil
+}
+
+// Size returns the width and height of the PAM image.
+func (pam *PAM) Size() (int, int) {
+	return pam.width, pam.height
+}
+
+// MagicNumber returns the magic number of the PAM image, which is always P7.
+func (pam *PAM) MagicNumber() string {
+	return "P7"
+}
+
+// Depth returns the number of samples per pixel.
+func (pam *PAM) Depth() int {
+	return pam.depth
+}
+
+// MaxValue returns the maximum sample value of the PAM image.
+func (pam *PAM) MaxValue() uint16 {
+	return pam.max
+}
+
+// TupleType returns the TUPLTYPE of the PAM image, or "" if the header had none.
+func (pam *PAM) TupleType() string {
+	return pam.tupleType
+}
+
+// Pix returns the sample buffer: Depth samples per pixel, from 0 to the maximum value.
+// The tuple at column x and row y starts at index y*Stride()+x*Depth(). The buffer is shared with the image.
+func (pam *PAM) Pix() []uint16 {
+	return pam.pix
+}
+
+// Stride returns the distance in Pix between vertically adjacent pixels.
+func (pam *PAM) Stride() int {
+	return pam.stride
+}
+
+// pixOffset returns the index in pix of the first sample of the tuple at column x and row y.
+func (pam *PAM) pixOffset(x, y int) int {
+	return y*pam.stride + x*pam.depth
+}
+
+// row returns the samples of row y, sharing memory with the image.
+func (pam *PAM) row(y int) []uint16 {
+	i := pam.pixOffset(0, y)
+	n := pam.width * pam.depth
+	return pam.pix[i : i+n : i+n]
+}
+
+// Clone returns a deep copy of the image.
+func (pam *PAM) Clone() *PAM {
+	clone := newPAM(pam.width, pam.height, pam.depth, pam.max, pam.tupleType)
+	for i := 0; i < pam.height; i++ {
+		copy(clone.row(i), pam.row(i))
+	}
+	return clone
+}
+
+// Equal reports whether two images have the same size, depth, maximum value, tuple type and samples.
+// It returns false if other is nil.
+func (pam *PAM) Equal(other *PAM) bool {
+	if other == nil || pam.width != other.width || pam.height != other.height || pam.depth != other.depth ||
+		pam.max != other.max || pam.tupleType != other.tupleType {
+		return false
+	}
+	for i := 0; i < pam.height; i++ {
+		if !slices.Equal(pam.row(i), other.row(i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// SubImage returns the part of the image inside r, which shares its samples with the image.
+// The result starts at (0, 0), so the tuple at r.Min becomes the tuple at (0, 0) of the view.
+// r is clipped to the bounds of the image, and may end up empty.
+func (pam *PAM) SubImage(r image.Rectangle) *PAM {
+	r = r.Intersect(image.Rect(0, 0, pam.width, pam.height))
+	if r.Empty() {
+		return &PAM{depth: pam.depth, max: pam.max, tupleType: pam.tupleType}
+	}
+	return &PAM{
+		pix:       pam.pix[pam.pixOffset(r.Min.X, r.Min.Y):pam.pixOffset(r.Max.X, r.Max.Y-1)],
+		stride:    pam.stride,
+		width:     r.Dx(),
+		height:    r.Dy(),
+		depth:     pam.depth,
+		max:       pam.max,
+		tupleType: pam.tupleType,
+	}
+}
+
+// HasAlpha reports whether the tuple type carries an alpha channel as its last sample.
+func (pam *PAM) HasAlpha() bool {
+	return strings.HasSuffix(pam.tupleType, "_ALPHA")
+}
+
+// At returns a copy of the tuple at the specified coordinates (x, y),
+// x being the column and y the row. It panics if (x, y) is outside the image.
+func (pam *PAM) At(x, y int) []uint16 {
+	tuple := make([]uint16, pam.depth)
+	copy(tuple, pam.row(y)[x*pam.depth:(x+1)*pam.depth])
+	return tuple
+}
+
+// Set sets the tuple at the specified coordinates (x, y).
+// Only the first Depth values of tuple are used.
+// It panics if (x, y) is outside the image.
+func (pam *PAM) Set(x, y int, tuple []uint16) {
+	copy(pam.row(y)[x*pam.depth:(x+1)*pam.depth], tuple)
+}
+
+// AtOK returns a copy of the tuple at the specified coordinates (x, y),
+// and false if (x, y) is outside the image.
+func (pam *PAM) AtOK(x, y int) ([]uint16, bool) {
+	if x < 0 || y < 0 || x >= pam.width || y >= pam.height {
+		return nil, false
+	}
+	return pam.At(x, y), true
+}
+
+// SetChecked sets the tuple at the specified coordinates (x, y), and returns
+// ErrOutOfBounds if (x, y) is outside the image.
+func (pam *PAM) SetChecked(x, y int, tuple []uint16) error {
+	if x < 0 || y < 0 || x >= pam.width || y >= pam.height {
+		return fmt.Errorf("%w: (%d, %d) in %dx%d PAM", ErrOutOfBounds, x, y, pam.width, pam.height)
+	}
+	pam.Set(x, y, tuple)
+	return nil
+}
+
+// Save saves the PAM image to a file and returns an error if there was a problem.
+func (pam *PAM) Save(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+
+	if err := EncodePAM(file, pam); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// EncodePAM writes the PAM image to w and returns an error if there was a problem.
+func EncodePAM(w io.Writer, pam *PAM) error {
+	if err := checkDimensions(pam.width, pam.height, pam.depth); err != nil {
+		return err
+	}
+	if pam.max == 0 {
+		return ErrInvalidMaxValue
+	}
+
+	logger().Debug("netpbm: writing PAM", "width", pam.width, "height", pam.height, "depth", pam.depth,
+		"tupleType", pam.tupleType, "bytesPerSample", bytesPerSample(pam.max))
+	writer := bufio.NewWriter(w)
+
+	// Write the PAM header
+	_, err := fmt.Fprintf(writer, "P7\nWIDTH %d\nHEIGHT %d\nDEPTH %d\nMAXVAL %d\n", pam.width, pam.height, pam.depth, pam.max)
+	if err != nil {
+		return err
+	}
+	if pam.tupleType != "" {
+		if _, err := fmt.Fprintf(writer, "TUPLTYPE %s\n", pam.tupleType); err != nil {
+			return err
+		}
+	}
+	if _, err := writer.WriteString("ENDHDR\n"); err != nil {
+		return err
+	}
+
+	// Write raw samples
+	raw := make([]byte, pam.width*pam.depth*bytesPerSample(pam.max))
+	for i := 0; i < pam.height; i++ {
+		writeSamples(raw, pam.row(i), pam.max)
+		if _, err := writer.Write(raw); err != nil {
+			return err
+		}
+	}
+
+	return writer.Flush()
+}
+
+// colorChannels returns how many leading samples of each tuple hold color:
+// 3 for RGB images, 1 for grayscale and black-and-white images.
+func (pam *PAM) colorChannels() int {
+	// Tuples too short for RGB can only be read as gray
+	if pam.depth < 3 {
+		return 1
+	}
+	return tupleColorChannels(pam.tupleType, pam.depth)
+}
+
+// tupleColorChannels returns how many leading samples of each tuple hold
+// color, for the given tuple type and depth.
+func tupleColorChannels(tupleType string, depth int) int {
+	switch strings.TrimSuffix(tupleType, "_ALPHA") {
+	case TupleTypeRGB:
+		return 3
+	case TupleTypeGrayscale, TupleTypeBlackAndWhite:
+		return 1
+	}
+	// Unknown tuple type: guess from the depth
+	logger().Debug("netpbm: unknown PAM tuple type, guessing channels from depth", "tupleType", tupleType, "depth", depth)
+	if depth >= 3 {
+		return 3
+	}
+	return 1
+}
+
+// Alpha returns the alpha channel of the PAM image as a PGM image,
+// or nil if the image has no alpha channel.
+func (pam *PAM) Alpha() *PGM {
+	if !pam.HasAlpha() {
+		return nil
+	}
+
+	pgm := newPGM(pam.width, pam.height, "P2", pam.max)
+	for i := 0; i < pam.height; i++ {
+		src, dst := pam.row(i), pgm.row(i)
+		for j := range dst {
+			dst[j] = src[(j+1)*pam.depth-1]
+		}
+	}
+
+	return pgm
+}
+
+// AddAlpha appends the given PGM image as an alpha channel, rescaling it to the
+// maximum value of the PAM image. It replaces any existing alpha channel.
+func (pam *PAM) AddAlpha(alpha *PGM) error {
+	if alpha.width != pam.width || alpha.height != pam.height {
+		return fmt.Errorf("alpha channel is %dx%d, image is %dx%d", alpha.width, alpha.height, pam.width, pam.height)
+	}
+
+	depth := pam.depth
+	if pam.HasAlpha() {
+		depth--
+	}
+	tupleType := strings.TrimSuffix(pam.tupleType, "_ALPHA")
+	if tupleType == "" {
+		tupleType = TupleTypeGrayscale
+		if depth >= 3 {
+			tupleType = TupleTypeRGB
+		}
+	}
+
+	dst := newPAM(pam.width, pam.height, depth+1, pam.max, tupleType+"_ALPHA")
+	for i := 0; i < pam.height; i++ {
+		src, row, a := pam.row(i), dst.row(i), alpha.row(i)
+		for j := 0; j < pam.width; j++ {
+			copy(row[j*(depth+1):], src[j*pam.depth:j*pam.depth+depth])
+			row[j*(depth+1)+depth] = uint16(uint32(a[j]) * uint32(pam.max) / uint32(alpha.max))
+		}
+	}
+	*pam = *dst
+	return nil
+}
+
+// ToPBM converts the PAM image to a PBM image, dropping any alpha channel.
+// The image is converted to gray as ToPGM does, then to black and white as
+// PGM.ToPBM does, with at most one DitherOptions.
+func (pam *PAM) ToPBM(opts ...DitherOptions) *PBM {
+	return pam.ToPGM().ToPBM(opts...)
+}
+
+// ToPGM converts the PAM image to a PGM image, dropping any alpha channel.
+// RGB tuples are converted to the average of their components.
+func (pam *PAM) ToPGM() *PGM {
+	channels := pam.colorChannels()
+
+	pgm := newPGM(pam.width, pam.height, "P2", pam.max)
+	for i := 0; i < pam.height; i++ {
+		src, dst := pam.row(i), pgm.row(i)
+		for j := range dst {
+			tuple := src[j*pam.depth:]
+			if channels == 3 {
+				dst[j] = uint16((uint32(tuple[0]) + uint32(tuple[1]) + uint32(tuple[2])) / 3)
+			} else {
+				dst[j] = tuple[0]
+			}
+		}
+	}
+
+	return pgm
+}
+
+// ToPPM converts the PAM image to a PPM image, dropping any alpha channel.
+// Grayscale tuples are replicated into all three components.
+func (pam *PAM) ToPPM() *PPM {
+	channels := pam.colorChannels()
+
+	ppm := newPPM(pam.width, pam.height, "P3", pam.max)
+	for i := 0; i < pam.height; i++ {
+		src, dst := pam.row(i), ppm.row(i)
+		for j := 0; j < pam.width; j++ {
+			tuple := src[j*pam.depth:]
+			if channels == 3 {
+				copy(dst[3*j:3*j+3], tuple[:3])
+			} else {
+				dst[3*j], dst[3*j+1], dst[3*j+2] = tuple[0], tuple[0], tuple[0]
+			}
+		}
+	}
+
+	return ppm
+}
+
+// ToPAM converts the PBM image to a BLACKANDWHITE PAM image.
+// In PAM a sample of 1 is white, so set (black) PBM pixels become 0.
+func (pbm *PBM) ToPAM() *PAM {
+	pam := newPAM(pbm.width, pbm.height, 1, 1, TupleTypeBlackAndWhite)
+	for i := 0; i < pbm.height; i++ {
+		dst := pam.row(i)
+		for j, pixel := range pbm.row(i) {
+			dst[j] = uint16(pixel ^ 1)
+		}
+	}
+
+	return pam
+}
+
+// ToPAM converts the PGM image to a GRAYSCALE PAM image.
+func (pgm *PGM) ToPAM() *PAM {
+	pam := newPAM(pgm.width, pgm.height, 1, pgm.max, TupleTypeGrayscale)
+	for i := 0; i < pgm.height; i++ {
+		copy(pam.row(i), pgm.row(i))
+	}
+
+	return pam
+}
+
+// ToPAM converts the PPM image to an RGB PAM image.
+func (ppm *PPM) ToPAM() *PAM {
+	pam := newPAM(ppm.width, ppm.height, 3, ppm.max, TupleTypeRGB)
+	for i := 0; i < ppm.height; i++ {
+		copy(pam.row(i), ppm.row(i))
+	}
+
+	return pam
+}
@@ -2,99 +2,125 @@ package Netpbm
 
 import (
 	"bufio"
-	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"io"
 	"os"
-	"strconv"
-	"strings"
+	"slices"
 )
 
+// Structure of a PBM image. Pixels are addressed as (x, y), x being the column
+// counted from the left and y the row counted from the top; true is black.
 type PBM struct {
-	data        [][]bool
+	// pix holds one byte per pixel, 1 for black and 0 for white, row after row.
+	pix []uint8
+	// stride is the distance in pix between vertically adjacent pixels.
+	stride      int
 	width       int
 	height      int
 	magicNumber string
 }
 
-// Function to read a PBM image.
-func ReadPBM(filename string) (*PBM, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+// Function that allocates a white PBM image of the given size.
+func newPBM(width, height int, magicNumber string) *PBM {
+	return &PBM{
+		pix:         make([]uint8, width*height),
+		stride:      width,
+		width:       width,
+		height:      height,
+		magicNumber: magicNumber,
 	}
-	defer file.Close()
-
-	scanner := bufio.NewScanner(file)
-	var magicNumber string
+}
 
-	// Function to read each line one by one.
-	readNextLine := func() (string, error) {
-		for scanner.Scan() {
-			line := strings.TrimSpace(scanner.Text())
-			// Skip potential comments.
-			if line != "" && !strings.HasPrefix(line, "#") {
-				return line, nil
-			}
-		}
-		return "", scanner.Err()
+// Function that creates a PBM image of the given size, white unless fill is given and true.
+// The magic number must be P1 or P4.
+func NewPBM(width, height int, magicNumber string, fill ...bool) (*PBM, error) {
+	if err := checkDimensions(width, height, 1); err != nil {
+		return nil, err
 	}
-
-	// Read the first uncommented line to get the magic number.
-	if magicNumber, err = readNextLine(); err != nil {
+	if magicNumber != "P1" && magicNumber != "P4" {
+		return nil, fmt.Errorf("%w: %q is not a PBM magic number", ErrBadMagic, magicNumber)
+	}
+	if err := checkFill(len(fill)); err != nil {
 		return nil, err
 	}
 
-	if magicNumber != "P1" && magicNumber != "P4" {
-		return nil, errors.New("unsupported file type")
+	pbm := newPBM(width, height, magicNumber)
+	if len(fill) == 1 && fill[0] {
+		for i := range pbm.pix {
+			pbm.pix[i] = 1
+		}
 	}
+	return pbm, nil
+}
 
-	dimensions, err := readNextLine()
+// Function to read a PBM image.
+func ReadPBM(filename string) (*PBM, error) {
+	file, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
-	// Read the second uncommented line to get width and height.
-	dimTokens := strings.Fields(dimensions)
-	if len(dimTokens) != 2 {
-		return nil, errors.New("invalid image dimensions")
-	}
+	defer file.Close()
 
-	width, _ := strconv.Atoi(dimTokens[0])
-	height, _ := strconv.Atoi(dimTokens[1])
+	return DecodePBM(file)
+}
 
-	var data [][]bool
+// Function to decode a PBM image from a reader.
+func DecodePBM(r io.Reader) (*PBM, error) {
+	tokens := newTokenReader(r)
 
-	// If the image is empty, initialize data with an empty slice.
-	if width > 0 && height > 0 {
-		data = make([][]bool, height)
-		for i := range data {
-			data[i] = make([]bool, width)
-		}
+	hdr, err := tokens.readHeader("P1", "P4")
+	if err != nil {
+		return nil, err
+	}
+	magicNumber, width, height := hdr.magicNumber, hdr.width, hdr.height
+
+	// The buffer grows as rows are read, so the image starts out empty
+	pbm := newPBM(width, 0, magicNumber)
 
-		if magicNumber == "P1" {
-			for i := 0; i < height; i++ {
-				line, err := readNextLine()
+	logger().Debug("netpbm: reading PBM raster", "magicNumber", magicNumber, "packed", magicNumber == "P4")
+	if magicNumber == "P1" {
+		// Pixels are read one by one, regardless of how lines are laid out.
+		pbm.pix, err = readRaster(pbm.pix, width*height, func(dst []uint8) error {
+			for j := range dst {
+				bit, err := tokens.bit()
 				if err != nil {
-					return nil, err
+					return err
 				}
-
-				tokens := strings.Fields(line)
-				for j, token := range tokens {
-					pixel, err := strconv.Atoi(token)
-					if err != nil {
-						return nil, err
-					}
-					data[i][j] = pixel == 1
+				dst[j] = 0
+				if bit {
+					dst[j] = 1
 				}
 			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Each row is packed 8 pixels per byte, most significant bit first.
+		// Chunks hold a multiple of 8 pixels, so they start on a byte boundary.
+		packed := make([]byte, (min(width, rasterChunk)+7)/8)
+		unpack := func(dst []uint8) error {
+			buf := packed[:(len(dst)+7)/8]
+			if err := tokens.readFull(buf); err != nil {
+				return err
+			}
+			for j := range dst {
+				dst[j] = buf[j/8] >> uint(7-j%8) & 1
+			}
+			return nil
+		}
+		for i := 0; i < height; i++ {
+			if pbm.pix, err = readRaster(pbm.pix, width, unpack); err != nil {
+				return nil, err
+			}
 		}
 	}
+	pbm.height = height
 
-	return &PBM{
-		data:        data,
-		width:       width,
-		height:      height,
-		magicNumber: magicNumber,
-	}, nil
+	return pbm, nil
 }
 
 // Function that returns the width and height of the PBM image.
@@ -102,14 +128,129 @@ func (pbm *PBM) Size() (int, int) {
 	return pbm.width, pbm.height
 }
 
-// Function that returns the value of a pixel at the specified coordinates.
-func (pbm *PBM) At(x, y int) bool {
-	return pbm.data[x][y]
+// Function that returns the magic number of the PBM image.
+func (pbm *PBM) MagicNumber() string {
+	return pbm.magicNumber
+}
+
+// Function that returns the pixel buffer: one byte per pixel, 1 for black and 0 for white.
+// The pixel at column x and row y is at index y*Stride()+x. The buffer is shared with the image.
+func (pbm *PBM) Pix() []uint8 {
+	return pbm.pix
+}
+
+// Function that returns the distance in Pix between vertically adjacent pixels.
+func (pbm *PBM) Stride() int {
+	return pbm.stride
+}
+
+// Function that returns the index in pix of the pixel at column x and row y.
+func (pbm *PBM) pixOffset(x, y int) int {
+	return y*pbm.stride + x
 }
 
-// Function that changes the value of a pixel at the specified coordinates.
-func (pbm *PBM) Set(x, y int, value bool) {
-	pbm.data[x][y] = value
+// Function that returns the pixels of row y, sharing memory with the image.
+func (pbm *PBM) row(y int) []uint8 {
+	i := pbm.pixOffset(0, y)
+	return pbm.pix[i : i+pbm.width : i+pbm.width]
+}
+
+// Function that returns a deep copy of the image.
+func (pbm *PBM) Clone() *PBM {
+	clone := newPBM(pbm.width, pbm.height, pbm.magicNumber)
+	for i := 0; i < pbm.height; i++ {
+		copy(clone.row(i), pbm.row(i))
+	}
+	return clone
+}
+
+// Function that reports whether two images have the same magic number, size and pixels. It returns false if other is nil.
+func (pbm *PBM) Equal(other *PBM) bool {
+	if other == nil || pbm.magicNumber != other.magicNumber || pbm.width != other.width || pbm.height != other.height {
+		return false
+	}
+	for i := 0; i < pbm.height; i++ {
+		if !slices.Equal(pbm.row(i), other.row(i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// Function that returns the part of the image inside r, which shares its pixels with the image.
+// The result starts at (0, 0), so the pixel at r.Min becomes the pixel at (0, 0) of the view.
+// r is clipped to the bounds of the image, and may end up empty.
+func (pbm *PBM) SubImage(r image.Rectangle) *PBM {
+	r = r.Intersect(pbm.Bounds())
+	if r.Empty() {
+		return &PBM{magicNumber: pbm.magicNumber}
+	}
+	return &PBM{
+		pix:         pbm.pix[pbm.pixOffset(r.Min.X, r.Min.Y):pbm.pixOffset(r.Max.X, r.Max.Y-1)],
+		stride:      pbm.stride,
+		width:       r.Dx(),
+		height:      r.Dy(),
+		magicNumber: pbm.magicNumber,
+	}
+}
+
+// Function that returns the value of the pixel at column x and row y. It panics if (x, y) is outside the image.
+func (pbm *PBM) BitAt(x, y int) bool {
+	return pbm.row(y)[x] != 0
+}
+
+// Function that changes the value of the pixel at column x and row y. It panics if (x, y) is outside the image.
+func (pbm *PBM) SetBit(x, y int, value bool) {
+	row := pbm.row(y)
+	if value {
+		row[x] = 1
+	} else {
+		row[x] = 0
+	}
+}
+
+// Function that returns the value of the pixel at column x and row y, and false if (x, y) is outside the image.
+func (pbm *PBM) BitAtOK(x, y int) (bool, bool) {
+	if !(image.Point{x, y}.In(pbm.Bounds())) {
+		return false, false
+	}
+	return pbm.BitAt(x, y), true
+}
+
+// Function that changes the value of the pixel at column x and row y, and returns ErrOutOfBounds if (x, y) is outside the image.
+func (pbm *PBM) SetBitChecked(x, y int, value bool) error {
+	if !(image.Point{x, y}.In(pbm.Bounds())) {
+		return fmt.Errorf("%w: (%d, %d) in %dx%d PBM", ErrOutOfBounds, x, y, pbm.width, pbm.height)
+	}
+	pbm.SetBit(x, y, value)
+	return nil
+}
+
+// Function that returns the color model of the image, a black and white palette.
+func (pbm *PBM) ColorModel() color.Model {
+	return bitmapPalette
+}
+
+// Function that returns the bounds of the image, as required by image.Image.
+func (pbm *PBM) Bounds() image.Rectangle {
+	return image.Rect(0, 0, pbm.width, pbm.height)
+}
+
+// Function that returns the color of the pixel at column x and row y, as required by image.Image.
+// Pixels outside the image are white, the color of an unset pixel.
+func (pbm *PBM) At(x, y int) color.Color {
+	if (image.Point{x, y}.In(pbm.Bounds())) && pbm.BitAt(x, y) {
+		return color.Black
+	}
+	return color.White
+}
+
+// Function that sets the pixel at column x and row y to the closest of black and white, as required by draw.Image.
+func (pbm *PBM) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(pbm.Bounds())) {
+		return
+	}
+	pbm.SetBit(x, y, bitmapPalette.Index(c) == 1)
 }
 
 // Function that saves a PBM image.
@@ -118,31 +259,66 @@ func (pbm *PBM) Save(filename string) error {
 	if err != nil {
 		return err
 	}
-	// Close the file at the end of the function.
-	defer fileSave.Close()
 
-	fmt.Fprintf(fileSave, "%s\n%d %d\n", pbm.magicNumber, pbm.width, pbm.height)
+	if err := EncodePBM(fileSave, pbm); err != nil {
+		fileSave.Close()
+		return err
+	}
+	return fileSave.Close()
+}
 
+// Function that encodes a PBM image to a writer.
+func EncodePBM(w io.Writer, pbm *PBM) error {
+	if pbm.magicNumber != "P1" && pbm.magicNumber != "P4" {
+		return fmt.Errorf("%w: %q is not a PBM magic number", ErrBadMagic, pbm.magicNumber)
+	}
+	if err := checkDimensions(pbm.width, pbm.height, 1); err != nil {
+		return err
+	}
+
+	logger().Debug("netpbm: writing PBM", "magicNumber", pbm.magicNumber, "width", pbm.width, "height", pbm.height)
+	writer := bufio.NewWriter(w)
+
+	if _, err := fmt.Fprintf(writer, "%s\n%d %d\n", pbm.magicNumber, pbm.width, pbm.height); err != nil {
+		return err
+	}
+
+	// Write errors in the plain raster are kept by the buffered writer and reported by Flush.
 	if pbm.magicNumber == "P1" {
-		for _, row := range pbm.data {
-			for _, pixel := range row {
-				if pixel {
-					fmt.Fprint(fileSave, "1 ")
+		for i := 0; i < pbm.height; i++ {
+			for _, pixel := range pbm.row(i) {
+				if pixel != 0 {
+					fmt.Fprint(writer, "1 ")
 				} else {
-					fmt.Fprint(fileSave, "0 ")
+					fmt.Fprint(writer, "0 ")
 				}
 			}
-			fmt.Fprintln(fileSave)
+			fmt.Fprintln(writer)
+		}
+	} else if pbm.magicNumber == "P4" {
+		// Pack 8 pixels per byte, most significant bit first, padding each row to a whole byte.
+		packed := make([]byte, (pbm.width+7)/8)
+		for i := 0; i < pbm.height; i++ {
+			for j := range packed {
+				packed[j] = 0
+			}
+			for j, pixel := range pbm.row(i) {
+				packed[j/8] |= pixel << uint(7-j%8)
+			}
+			if _, err := writer.Write(packed); err != nil {
+				return err
+			}
 		}
 	}
-	return nil
+	return writer.Flush()
 }
 
 // Function that inverts the colors of the image.
 func (pbm *PBM) Invert() {
 	for i := 0; i < pbm.height; i++ {
-		for j := 0; j < pbm.width; j++ {
-			pbm.data[i][j] = !pbm.data[i][j]
+		row := pbm.row(i)
+		for j := range row {
+			row[j] ^= 1
 		}
 	}
 }
@@ -150,16 +326,20 @@ func (pbm *PBM) Invert() {
 // Function that horizontally flips the image.
 func (pbm *PBM) Flip() {
 	for i := 0; i < pbm.height; i++ {
+		row := pbm.row(i)
 		for j, k := 0, pbm.width-1; j < k; j, k = j+1, k-1 {
-			pbm.data[i][j], pbm.data[i][k] = pbm.data[i][k], pbm.data[i][j]
+			row[j], row[k] = row[k], row[j]
 		}
 	}
 }
 
 // Function that vertically flips the image.
 func (pbm *PBM) Flop() {
+	tmp := make([]uint8, pbm.width)
 	for i, j := 0, pbm.height-1; i < j; i, j = i+1, j-1 {
-		pbm.data[i], pbm.data[j] = pbm.data[j], pbm.data[i]
+		copy(tmp, pbm.row(i))
+		copy(pbm.row(i), pbm.row(j))
+		copy(pbm.row(j), tmp)
 	}
 }
 
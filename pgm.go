@@ -3,139 +3,329 @@ package Netpbm
 import (
 	"bufio"
 	"fmt"
-	"log"
+	"image"
+	"image/color"
+	"io"
 	"os"
-	"strconv"
-	"strings"
+	"slices"
 )
 
+// Structure of a PGM image. Pixels are addressed as (x, y), x being the column
+// counted from the left and y the row counted from the top.
 type PGM struct {
-	data          [][]uint8
+	// pix holds one sample per pixel, row after row.
+	pix []uint16
+	// stride is the distance in pix between vertically adjacent pixels.
+	stride        int
 	width, height int
 	magicNumber   string
-	max           uint8
+	max           uint16
+}
+
+// Function that allocates a black PGM image of the given size.
+func newPGM(width, height int, magicNumber string, max uint16) *PGM {
+	return &PGM{
+		pix:         make([]uint16, width*height),
+		stride:      width,
+		width:       width,
+		height:      height,
+		magicNumber: magicNumber,
+		max:         max,
+	}
+}
+
+// Function that creates a PGM image of the given size, black unless a fill value is given.
+// The magic number must be P2 or P5 and the maximum value at least 1.
+func NewPGM(width, height int, magicNumber string, max uint16, fill ...uint16) (*PGM, error) {
+	if err := checkDimensions(width, height, 1); err != nil {
+		return nil, err
+	}
+	if magicNumber != "P2" && magicNumber != "P5" {
+		return nil, fmt.Errorf("%w: %q is not a PGM magic number", ErrBadMagic, magicNumber)
+	}
+	if max == 0 {
+		return nil, ErrInvalidMaxValue
+	}
+	if err := checkFill(len(fill)); err != nil {
+		return nil, err
+	}
+
+	pgm := newPGM(width, height, magicNumber, max)
+	if len(fill) == 1 {
+		if fill[0] > max {
+			return nil, fmt.Errorf("%w: fill value %d exceeds maximum value %d", ErrInvalidSample, fill[0], max)
+		}
+		for i := range pgm.pix {
+			pgm.pix[i] = fill[0]
+		}
+	}
+	return pgm, nil
 }
 
 // Function to read a PGM image.
 func ReadPGM(filename string) (*PGM, error) {
-	var dimension string
-
 	file, err := os.Open(filename)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
 	}
 	// Close the file at the end of the function.
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	return DecodePGM(file)
+}
+
+// Function to decode a PGM image from a reader.
+func DecodePGM(r io.Reader) (*PGM, error) {
+	tokens := newTokenReader(r)
 
-	if err := scanner.Err(); err != nil {
-		log.Fatalln(err)
+	// Read the magic number, dimensions and maximum pixel value
+	hdr, err := tokens.readHeader("P2", "P5")
+	if err != nil {
 		return nil, err
 	}
+	magicNumber, width, height, max := hdr.magicNumber, hdr.width, hdr.height, hdr.max
 
-	// Read the magic number
-	scanner.Scan()
-	magicNumber := scanner.Text()
+	// The buffer grows as pixels are read, so the image starts out empty
+	pgm := newPGM(width, 0, magicNumber, uint16(max))
 
-	// Skip comments
-	for scanner.Scan() {
-		if scanner.Text()[0] == '#' {
-			continue
-		}
-		break
+	// Read pixel values
+	logger().Debug("netpbm: reading PGM raster", "magicNumber", magicNumber, "bytesPerSample", bytesPerSample(uint16(max)))
+	if magicNumber == "P2" {
+		// Values are whitespace-separated, regardless of how lines are laid out
+		pgm.pix, err = readRaster(pgm.pix, width*height, func(dst []uint16) error {
+			for j := range dst {
+				v, err := tokens.sample(max)
+				if err != nil {
+					return err
+				}
+				dst[j] = v
+			}
+			return nil
+		})
+	} else if magicNumber == "P5" {
+		// One byte per pixel (two big-endian bytes above 255), rows stored one after the other.
+		raw := make([]byte, min(width*height, rasterChunk)*bytesPerSample(uint16(max)))
+		pgm.pix, err = readRaster(pgm.pix, width*height, func(dst []uint16) error {
+			return tokens.readSamples(dst, raw, uint16(max))
+		})
 	}
+	if err != nil {
+		return nil, err
+	}
+	pgm.height = height
 
-	// Read dimensions
-	dimension = scanner.Text()
-	res := strings.Split(dimension, " ")
-	height, _ := strconv.Atoi(res[1])
-	width, _ := strconv.Atoi(res[0])
+	return pgm, nil
+}
 
-	// Read maximum pixel value
-	scanner.Scan()
-	max, _ := strconv.Atoi(scanner.Text())
-	data := make([][]uint8, height)
-	for i := range data {
-		data[i] = make([]uint8, width)
+// Function that returns the width and height of the PGM image.
+func (pgm *PGM) Size() (int, int) {
+	return pgm.width, pgm.height
+}
+
+// Function that returns the magic number of the PGM image.
+func (pgm *PGM) MagicNumber() string {
+	return pgm.magicNumber
+}
+
+// Function that returns the pixel buffer: one sample per pixel, from 0 to the maximum value.
+// The pixel at column x and row y is at index y*Stride()+x. The buffer is shared with the image.
+func (pgm *PGM) Pix() []uint16 {
+	return pgm.pix
+}
+
+// Function that returns the distance in Pix between vertically adjacent pixels.
+func (pgm *PGM) Stride() int {
+	return pgm.stride
+}
+
+// Function that returns the index in pix of the pixel at column x and row y.
+func (pgm *PGM) pixOffset(x, y int) int {
+	return y*pgm.stride + x
+}
+
+// Function that returns the samples of row y, sharing memory with the image.
+func (pgm *PGM) row(y int) []uint16 {
+	i := pgm.pixOffset(0, y)
+	return pgm.pix[i : i+pgm.width : i+pgm.width]
+}
+
+// Function that returns a deep copy of the image.
+func (pgm *PGM) Clone() *PGM {
+	clone := newPGM(pgm.width, pgm.height, pgm.magicNumber, pgm.max)
+	for i := 0; i < pgm.height; i++ {
+		copy(clone.row(i), pgm.row(i))
 	}
+	return clone
+}
 
-	// Read pixel values
-	if magicNumber == "P2" {
-		for i := 0; i < height; i++ {
-			scanner.Scan()
-			line := scanner.Text()
-			caseBytes := strings.Fields(line)
-
-			for j := 0; j < width; j++ {
-				caseInt, _ := strconv.Atoi(caseBytes[j])
-				data[i][j] = uint8(caseInt)
-			}
+// Function that reports whether two images have the same magic number, size, maximum value and pixels. It returns false if other is nil.
+func (pgm *PGM) Equal(other *PGM) bool {
+	if other == nil || pgm.magicNumber != other.magicNumber || pgm.width != other.width || pgm.height != other.height || pgm.max != other.max {
+		return false
+	}
+	for i := 0; i < pgm.height; i++ {
+		if !slices.Equal(pgm.row(i), other.row(i)) {
+			return false
 		}
 	}
+	return true
+}
 
+// Function that returns the part of the image inside r, which shares its pixels with the image.
+// The result starts at (0, 0), so the pixel at r.Min becomes the pixel at (0, 0) of the view.
+// r is clipped to the bounds of the image, and may end up empty.
+func (pgm *PGM) SubImage(r image.Rectangle) *PGM {
+	r = r.Intersect(pgm.Bounds())
+	if r.Empty() {
+		return &PGM{magicNumber: pgm.magicNumber, max: pgm.max}
+	}
 	return &PGM{
-		data:        data,
-		width:       width,
-		height:      height,
-		magicNumber: magicNumber,
-		max:         uint8(max),
-	}, nil
+		pix:         pgm.pix[pgm.pixOffset(r.Min.X, r.Min.Y):pgm.pixOffset(r.Max.X, r.Max.Y-1)],
+		stride:      pgm.stride,
+		width:       r.Dx(),
+		height:      r.Dy(),
+		magicNumber: pgm.magicNumber,
+		max:         pgm.max,
+	}
 }
 
-// Function that returns the width and height of the PGM image.
-func (pgm *PGM) Size() (int, int) {
-	return pgm.width, pgm.height
+// Function that returns the value of the pixel at column x and row y. It panics if (x, y) is outside the image.
+func (pgm *PGM) GrayAt(x, y int) uint16 {
+	return pgm.row(y)[x]
+}
+
+// Function that changes the value of the pixel at column x and row y. It panics if (x, y) is outside the image.
+func (pgm *PGM) SetGray(x, y int, value uint16) {
+	pgm.row(y)[x] = value
+}
+
+// Function that returns the value of the pixel at column x and row y, and false if (x, y) is outside the image.
+func (pgm *PGM) GrayAtOK(x, y int) (uint16, bool) {
+	if !(image.Point{x, y}.In(pgm.Bounds())) {
+		return 0, false
+	}
+	return pgm.GrayAt(x, y), true
+}
+
+// Function that changes the value of the pixel at column x and row y, and returns ErrOutOfBounds if (x, y) is outside the image.
+func (pgm *PGM) SetGrayChecked(x, y int, value uint16) error {
+	if !(image.Point{x, y}.In(pgm.Bounds())) {
+		return fmt.Errorf("%w: (%d, %d) in %dx%d PGM", ErrOutOfBounds, x, y, pgm.width, pgm.height)
+	}
+	pgm.SetGray(x, y, value)
+	return nil
+}
+
+// Function that returns the color model of the image, 16-bit gray when the maximum value is above 255.
+func (pgm *PGM) ColorModel() color.Model {
+	return grayModel(pgm.max)
+}
+
+// Function that returns the bounds of the image, as required by image.Image.
+func (pgm *PGM) Bounds() image.Rectangle {
+	return image.Rect(0, 0, pgm.width, pgm.height)
 }
 
-// Function that returns the value of a pixel at the specified coordinates.
-func (pgm *PGM) At(x, y int) uint8 {
-	return pgm.data[x][y]
+// Function that returns the color of the pixel at column x and row y, scaled from the maximum value, as required by image.Image.
+func (pgm *PGM) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(pgm.Bounds())) {
+		return color.Gray{}
+	}
+	if pgm.max > 255 {
+		return color.Gray16{scaleSample(pgm.GrayAt(x, y), pgm.max, 0xffff)}
+	}
+	return color.Gray{uint8(scaleSample(pgm.GrayAt(x, y), pgm.max, 0xff))}
 }
 
-// Function that changes the value of a pixel at the specified coordinates.
-func (pgm *PGM) Set(x, y int, value uint8) {
-	pgm.data[x][y] = value
+// Function that sets the pixel at column x and row y to the gray level of c, scaled to the maximum value, as required by draw.Image.
+func (pgm *PGM) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(pgm.Bounds())) {
+		return
+	}
+	gray := color.Gray16Model.Convert(c).(color.Gray16)
+	pgm.SetGray(x, y, scaleSample(gray.Y, 0xffff, pgm.max))
 }
 
 // Function that saves a PGM image.
 func (pgm *PGM) Save(filename string) error {
 	file, err := os.Create(filename)
 	if err != nil {
-		fmt.Println("Error creating file")
 		return err
 	}
-	// Close the file at the end of the function.
-	defer file.Close()
 
-	_, err = file.WriteString(fmt.Sprintf("%v\n%v %v\n%v\n", pgm.magicNumber, pgm.width, pgm.height, pgm.max))
+	if err := EncodePGM(file, pgm); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Function that encodes a PGM image to a writer.
+func EncodePGM(w io.Writer, pgm *PGM) error {
+	if pgm.magicNumber != "P2" && pgm.magicNumber != "P5" {
+		return fmt.Errorf("%w: %q is not a PGM magic number", ErrBadMagic, pgm.magicNumber)
+	}
+	if err := checkDimensions(pgm.width, pgm.height, 1); err != nil {
+		return err
+	}
+	if pgm.max == 0 {
+		return ErrInvalidMaxValue
+	}
+
+	logger().Debug("netpbm: writing PGM", "magicNumber", pgm.magicNumber, "width", pgm.width, "height", pgm.height,
+		"bytesPerSample", bytesPerSample(pgm.max))
+	writer := bufio.NewWriter(w)
+
+	_, err := writer.WriteString(fmt.Sprintf("%v\n%v %v\n%v\n", pgm.magicNumber, pgm.width, pgm.height, pgm.max))
 	if err != nil {
-		fmt.Println("Error writing to file")
 		return err
 	}
 
+	// Write raw pixel values, one byte per pixel (two big-endian bytes above 255)
+	if pgm.magicNumber == "P5" {
+		row := make([]byte, pgm.width*bytesPerSample(pgm.max))
+		for i := 0; i < pgm.height; i++ {
+			writeSamples(row, pgm.row(i), pgm.max)
+			_, err = writer.Write(row)
+			if err != nil {
+				return err
+			}
+		}
+		return writer.Flush()
+	}
+
 	// Write pixel values
 	for i := 0; i < pgm.height; i++ {
-		for j := 0; j < pgm.width; j++ {
-			var pixel uint8
-			pixel = pgm.data[i][j]
-			_, err = file.WriteString(fmt.Sprintf("%v ", pixel))
+		for _, pixel := range pgm.row(i) {
+			_, err = writer.WriteString(fmt.Sprintf("%v ", pixel))
 			if err != nil {
-				fmt.Println("Error writing to file")
 				return err
 			}
 		}
-		_, err = file.WriteString(fmt.Sprintf("\n"))
+		if _, err = writer.WriteString("\n"); err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return writer.Flush()
+}
+
+// Function that returns the maximum pixel value of the image.
+func (pgm *PGM) MaxValue() uint16 {
+	return pgm.max
+}
+
+// Function that reports whether the image uses 16-bit samples (maximum value above 255).
+func (pgm *PGM) Is16Bit() bool {
+	return pgm.max > 255
 }
 
 // Function that inverts the colors of the image.
 func (pgm *PGM) Invert() {
 	for i := 0; i < pgm.height; i++ {
-		for j := 0; j < pgm.width; j++ {
-			pgm.data[i][j] = pgm.max - pgm.data[i][j]
+		row := pgm.row(i)
+		for j := range row {
+			row[j] = pgm.max - row[j]
 		}
 	}
 }
@@ -143,16 +333,20 @@ func (pgm *PGM) Invert() {
 // Function that horizontally flips the image.
 func (pgm *PGM) Flip() {
 	for i := 0; i < pgm.height; i++ {
+		row := pgm.row(i)
 		for j, k := 0, pgm.width-1; j < k; j, k = j+1, k-1 {
-			pgm.data[i][j], pgm.data[i][k] = pgm.data[i][k], pgm.data[i][j]
+			row[j], row[k] = row[k], row[j]
 		}
 	}
 }
 
 // Function that vertically flips the image.
 func (pgm *PGM) Flop() {
+	tmp := make([]uint16, pgm.width)
 	for i, j := 0, pgm.height-1; i < j; i, j = i+1, j-1 {
-		pgm.data[i], pgm.data[j] = pgm.data[j], pgm.data[i]
+		copy(tmp, pgm.row(i))
+		copy(pgm.row(i), pgm.row(j))
+		copy(pgm.row(j), tmp)
 	}
 }
 
@@ -161,70 +355,39 @@ func (pgm *PGM) SetMagicNumber(magicNumber string) {
 	pgm.magicNumber = magicNumber
 }
 
-// Function that sets a new maximum value for pixel intensity.
-func (pgm *PGM) SetMaxValue(maxValue uint8) {
+// Function that sets a new maximum value for pixel intensity. A maximum value of 0 cannot be encoded
+// and would lose every pixel, so it is ignored.
+func (pgm *PGM) SetMaxValue(maxValue uint16) {
+	if maxValue == 0 {
+		return
+	}
+
 	// Set the multiplier
 	multiplier := float64(maxValue) / float64(pgm.max)
 	// Update the maximum value
 	pgm.max = maxValue
 
 	// Update pixel values with the new maximum value
-	for i := range pgm.data {
-		for j := range pgm.data[i] {
+	for i := 0; i < pgm.height; i++ {
+		row := pgm.row(i)
+		for j := range row {
 			// Modify the value of each pixel proportionally
-			pgm.data[i][j] = uint8(float64(pgm.data[i][j]) * multiplier)
+			row[j] = uint16(float64(row[j]) * multiplier)
 		}
 	}
 }
 
 // Function that rotates the image 90 degrees clockwise.
 func (pgm *PGM) Rotate90CW() {
-	rotated := PGM{
-		data:        make([][]uint8, pgm.width),
-		width:       pgm.height,
-		height:      pgm.width,
-		magicNumber: pgm.magicNumber,
-		max:         pgm.max,
-	}
-
-	for i := range rotated.data {
-		rotated.data[i] = make([]uint8, rotated.width)
-	}
-
-	// Rotate pixel values
-	for i := 0; i < pgm.height; i++ {
-		for j := 0; j < pgm.width; j++ {
-			rotated.data[j][rotated.height-i-1] = pgm.data[i][j]
-		}
-	}
-
-	// Update the original PGM image
-	pgm.data, pgm.width, pgm.height = rotated.data, rotated.width, rotated.height
+	pgm.reorient(rotate90CW)
 }
 
-// Function that converts the PGM image to PBM format.
-func (pgm *PGM) ToPBM() *PBM {
-	var data [][]bool
-	data = make([][]bool, pgm.height)
-	for i := 0; i < pgm.height; i++ {
-		data[i] = make([]bool, pgm.width)
-	}
-
-	// Convert pixel values to binary
-	for i := 0; i < pgm.height; i++ {
-		for j := 0; j < pgm.width; j++ {
-			if pgm.data[i][j] > pgm.max/2 {
-				data[i][j] = true
-			} else {
-				data[i][j] = false
-			}
-		}
-	}
-
-	return &PBM{
-		data:        data,
-		width:       pgm.width,
-		height:      pgm.height,
-		magicNumber: "P1",
+// Function that converts the PGM image to PBM format. Dark pixels become black: by default those at or
+// below half the maximum value, or as spread by the dithering method of opts, of which at most one is used.
+func (pgm *PGM) ToPBM(opts ...DitherOptions) *PBM {
+	var o DitherOptions
+	if len(opts) > 0 {
+		o = opts[0]
 	}
+	return pgm.dither(o)
 }
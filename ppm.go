@@ -3,15 +3,18 @@ package Netpbm
 import (
 	"bufio"
 	"fmt"
+	"image"
+	"image/color"
+	"io"
 	"math"
 	"os"
-	"strconv"
-	"strings"
+	"slices"
 )
 
 // Pixel represents a color pixel with red (R), green (G), and blue (B) components.
+// Components range from 0 to the maximum value of the image, which may be up to 65535.
 type Pixel struct {
-	R, G, B uint8
+	R, G, B uint16
 }
 
 // Point represents a 2D point with X and Y coordinates.
@@ -19,12 +22,57 @@ type Point struct {
 	X, Y int
 }
 
-// PPM represents a Portable Pixmap image.
+// PPM represents a Portable Pixmap image. Pixels are addressed as (x, y), x
+// being the column counted from the left and y the row counted from the top.
 type PPM struct {
-	data          [][]Pixel
+	// pix holds three samples per pixel, in R, G, B order, row after row.
+	pix []uint16
+	// stride is the distance in pix between vertically adjacent pixels.
+	stride        int
 	width, height int
 	magicNumber   string
-	max           uint8
+	max           uint16
+}
+
+// newPPM allocates a black PPM image of the given size.
+func newPPM(width, height int, magicNumber string, max uint16) *PPM {
+	return &PPM{
+		pix:         make([]uint16, 3*width*height),
+		stride:      3 * width,
+		width:       width,
+		height:      height,
+		magicNumber: magicNumber,
+		max:         max,
+	}
+}
+
+// NewPPM creates a PPM image of the given size, black unless a fill color is given.
+// The magic number must be P3 or P6 and the maximum value at least 1.
+func NewPPM(width, height int, magicNumber string, max uint16, fill ...Pixel) (*PPM, error) {
+	if err := checkDimensions(width, height, 3); err != nil {
+		return nil, err
+	}
+	if magicNumber != "P3" && magicNumber != "P6" {
+		return nil, fmt.Errorf("%w: %q is not a PPM magic number", ErrBadMagic, magicNumber)
+	}
+	if max == 0 {
+		return nil, ErrInvalidMaxValue
+	}
+	if err := checkFill(len(fill)); err != nil {
+		return nil, err
+	}
+
+	ppm := newPPM(width, height, magicNumber, max)
+	if len(fill) == 1 {
+		c := fill[0]
+		if c.R > max || c.G > max || c.B > max {
+			return nil, fmt.Errorf("%w: fill color %v exceeds maximum value %d", ErrInvalidSample, c, max)
+		}
+		for i := 0; i < len(ppm.pix); i += 3 {
+			ppm.pix[i], ppm.pix[i+1], ppm.pix[i+2] = c.R, c.G, c.B
+		}
+	}
+	return ppm, nil
 }
 
 // ReadPPM reads a PPM image from a file and returns a structure representing the image.
@@ -35,68 +83,51 @@ func ReadPPM(filename string) (*PPM, error) {
 	}
 	defer file.Close()
 
-	scanner := bufio.NewScanner(file)
+	return DecodePPM(file)
+}
 
-	scanner.Scan()
-	line := scanner.Text()
-	line = strings.TrimSpace(line)
-	if line != "P3" && line != "P6" {
-		return nil, fmt.Errorf("Not a Portable Pixmap file: bad magic number %s", line)
-	}
-	magicNumber := line
+// DecodePPM decodes a PPM image from r and returns a structure representing the image.
+func DecodePPM(r io.Reader) (*PPM, error) {
+	tokens := newTokenReader(r)
 
-	// Read dimensions
-	for scanner.Scan() {
-		if strings.HasPrefix(scanner.Text(), "#") {
-			continue
-		}
-		break
+	// Read the magic number, dimensions and maximum color value
+	hdr, err := tokens.readHeader("P3", "P6")
+	if err != nil {
+		return nil, err
 	}
+	magicNumber, width, height, maxValue := hdr.magicNumber, hdr.width, hdr.height, hdr.max
 
-	dimension := strings.Fields(scanner.Text())
-	width, _ := strconv.Atoi(dimension[0])
-	height, _ := strconv.Atoi(dimension[1])
-
-	scanner.Scan()
-	maxValue, _ := strconv.Atoi(scanner.Text())
+	// The buffer grows as pixels are read, so the image starts out empty
+	ppm := newPPM(width, 0, magicNumber, uint16(maxValue))
+	samples := 3 * width * height
 
 	// Read pixel data
-	var ppm *PPM
+	logger().Debug("netpbm: reading PPM raster", "magicNumber", magicNumber, "bytesPerSample", bytesPerSample(uint16(maxValue)))
 	if magicNumber == "P3" {
-		data := make([][]Pixel, height)
-		for i := range data {
-			data[i] = make([]Pixel, width)
-		}
-
-		// Read pixel data for P3 format
-		for i := 0; i < height; i++ {
-			scanner.Scan()
-			line := scanner.Text()
-			values := strings.Fields(line)
-			for j := 0; j < width; j++ {
-				if j == 0 {
-					r, _ := strconv.Atoi(values[0])
-					g, _ := strconv.Atoi(values[1])
-					b, _ := strconv.Atoi(values[2])
-					data[i][j] = Pixel{uint8(r), uint8(g), uint8(b)}
-				} else {
-					r, _ := strconv.Atoi(values[3*j])
-					g, _ := strconv.Atoi(values[3*j+1])
-					b, _ := strconv.Atoi(values[3*j+2])
-					data[i][j] = Pixel{uint8(r), uint8(g), uint8(b)}
+		// Read pixel data for P3 format: values are whitespace-separated,
+		// regardless of how lines are laid out
+		ppm.pix, err = readRaster(ppm.pix, samples, func(dst []uint16) error {
+			for j := range dst {
+				v, err := tokens.sample(maxValue)
+				if err != nil {
+					return err
 				}
+				dst[j] = v
 			}
-		}
-
-		ppm = &PPM{
-			data:        data,
-			width:       width,
-			height:      height,
-			magicNumber: magicNumber,
-			max:         uint8(maxValue),
-		}
-		fmt.Printf("%+v\n", PPM{data, width, height, magicNumber, uint8(maxValue)})
+			return nil
+		})
+	} else {
+		// Read pixel data for P6 format: three samples per pixel, in R, G, B order,
+		// each one byte wide, or two big-endian bytes when the maximum value is above 255
+		raw := make([]byte, min(samples, rasterChunk)*bytesPerSample(uint16(maxValue)))
+		ppm.pix, err = readRaster(ppm.pix, samples, func(dst []uint16) error {
+			return tokens.readSamples(dst, raw, uint16(maxValue))
+		})
 	}
+	if err != nil {
+		return nil, err
+	}
+	ppm.height = height
 	return ppm, nil
 }
 
@@ -105,14 +136,155 @@ func (ppm *PPM) Size() (int, int) {
 	return ppm.width, ppm.height
 }
 
-// At returns the color pixel at the specified coordinates (x, y).
-func (ppm *PPM) At(x, y int) Pixel {
-	return ppm.data[y][x]
+// MagicNumber returns the magic number of the PPM image.
+func (ppm *PPM) MagicNumber() string {
+	return ppm.magicNumber
 }
 
-// Set sets the color pixel at the specified coordinates (x, y).
-func (ppm *PPM) Set(x, y int, value Pixel) {
-	ppm.data[y][x] = value
+// Pix returns the pixel buffer: three samples per pixel, in R, G, B order,
+// each from 0 to the maximum color value. The pixel at (x, y) starts at
+// index y*Stride()+3*x. The buffer is shared with the image.
+func (ppm *PPM) Pix() []uint16 {
+	return ppm.pix
+}
+
+// Stride returns the distance in Pix between vertically adjacent pixels.
+func (ppm *PPM) Stride() int {
+	return ppm.stride
+}
+
+// pixOffset returns the index in pix of the first sample of the pixel at (x, y).
+func (ppm *PPM) pixOffset(x, y int) int {
+	return y*ppm.stride + 3*x
+}
+
+// row returns the samples of row y, sharing memory with the image.
+func (ppm *PPM) row(y int) []uint16 {
+	i := ppm.pixOffset(0, y)
+	return ppm.pix[i : i+3*ppm.width : i+3*ppm.width]
+}
+
+// Clone returns a deep copy of the image.
+func (ppm *PPM) Clone() *PPM {
+	clone := newPPM(ppm.width, ppm.height, ppm.magicNumber, ppm.max)
+	for i := 0; i < ppm.height; i++ {
+		copy(clone.row(i), ppm.row(i))
+	}
+	return clone
+}
+
+// Equal reports whether two images have the same magic number, size, maximum value and pixels.
+// It returns false if other is nil.
+func (ppm *PPM) Equal(other *PPM) bool {
+	if other == nil || ppm.magicNumber != other.magicNumber || ppm.width != other.width || ppm.height != other.height || ppm.max != other.max {
+		return false
+	}
+	for i := 0; i < ppm.height; i++ {
+		if !slices.Equal(ppm.row(i), other.row(i)) {
+			return false
+		}
+	}
+	return true
+}
+
+// SubImage returns the part of the image inside r, which shares its pixels with the image.
+// The result starts at (0, 0), so the pixel at r.Min becomes the pixel at (0, 0) of the view.
+// r is clipped to the bounds of the image, and may end up empty.
+func (ppm *PPM) SubImage(r image.Rectangle) *PPM {
+	r = r.Intersect(ppm.Bounds())
+	if r.Empty() {
+		return &PPM{magicNumber: ppm.magicNumber, max: ppm.max}
+	}
+	return &PPM{
+		pix:         ppm.pix[ppm.pixOffset(r.Min.X, r.Min.Y):ppm.pixOffset(r.Max.X, r.Max.Y-1)],
+		stride:      ppm.stride,
+		width:       r.Dx(),
+		height:      r.Dy(),
+		magicNumber: ppm.magicNumber,
+		max:         ppm.max,
+	}
+}
+
+// PixelAt returns the color pixel at the specified coordinates (x, y).
+// It panics if (x, y) is outside the image.
+func (ppm *PPM) PixelAt(x, y int) Pixel {
+	s := ppm.row(y)[3*x : 3*x+3]
+	return Pixel{s[0], s[1], s[2]}
+}
+
+// SetPixel sets the color pixel at the specified coordinates (x, y).
+// It panics if (x, y) is outside the image.
+func (ppm *PPM) SetPixel(x, y int, value Pixel) {
+	s := ppm.row(y)[3*x : 3*x+3]
+	s[0], s[1], s[2] = value.R, value.G, value.B
+}
+
+// PixelAtOK returns the color pixel at the specified coordinates (x, y),
+// and false if (x, y) is outside the image.
+func (ppm *PPM) PixelAtOK(x, y int) (Pixel, bool) {
+	if !(image.Point{x, y}.In(ppm.Bounds())) {
+		return Pixel{}, false
+	}
+	return ppm.PixelAt(x, y), true
+}
+
+// SetPixelChecked sets the color pixel at the specified coordinates (x, y),
+// and returns ErrOutOfBounds if (x, y) is outside the image.
+func (ppm *PPM) SetPixelChecked(x, y int, value Pixel) error {
+	if !(image.Point{x, y}.In(ppm.Bounds())) {
+		return fmt.Errorf("%w: (%d, %d) in %dx%d PPM", ErrOutOfBounds, x, y, ppm.width, ppm.height)
+	}
+	ppm.SetPixel(x, y, value)
+	return nil
+}
+
+// ColorModel returns the color model of the PPM image: RGBA, or RGBA64 when
+// the maximum color value is above 255.
+func (ppm *PPM) ColorModel() color.Model {
+	return rgbModel(ppm.max, false)
+}
+
+// Bounds returns the bounds of the PPM image.
+func (ppm *PPM) Bounds() image.Rectangle {
+	return image.Rect(0, 0, ppm.width, ppm.height)
+}
+
+// At returns the color at the specified coordinates (x, y), scaled from the
+// maximum color value. It implements image.Image.
+func (ppm *PPM) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(ppm.Bounds())) {
+		return color.RGBA{}
+	}
+	pixel := ppm.PixelAt(x, y)
+	if ppm.max > 255 {
+		return color.RGBA64{
+			R: scaleSample(pixel.R, ppm.max, 0xffff),
+			G: scaleSample(pixel.G, ppm.max, 0xffff),
+			B: scaleSample(pixel.B, ppm.max, 0xffff),
+			A: 0xffff,
+		}
+	}
+	return color.RGBA{
+		R: uint8(scaleSample(pixel.R, ppm.max, 0xff)),
+		G: uint8(scaleSample(pixel.G, ppm.max, 0xff)),
+		B: uint8(scaleSample(pixel.B, ppm.max, 0xff)),
+		A: 0xff,
+	}
+}
+
+// Set sets the pixel at the specified coordinates (x, y) to c, scaled to the
+// maximum color value. Any transparency in c is dropped, which amounts to
+// compositing it over black. It implements draw.Image.
+func (ppm *PPM) Set(x, y int, c color.Color) {
+	if !(image.Point{x, y}.In(ppm.Bounds())) {
+		return
+	}
+	r, g, b, _ := c.RGBA()
+	ppm.SetPixel(x, y, Pixel{
+		R: scaleSample(uint16(r), 0xffff, ppm.max),
+		G: scaleSample(uint16(g), 0xffff, ppm.max),
+		B: scaleSample(uint16(b), 0xffff, ppm.max),
+	})
 }
 
 // Save saves the PPM image to a file and returns an error if there was a problem.
@@ -121,43 +293,83 @@ func (ppm *PPM) Save(filename string) error {
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	// Write the PPM header to the file
-	_, err = fmt.Fprintf(file, "%s\n%d %d\n%d\n", ppm.magicNumber, ppm.width, ppm.height, ppm.max)
+	if err := EncodePPM(file, ppm); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// EncodePPM writes the PPM image to w and returns an error if there was a problem.
+func EncodePPM(w io.Writer, ppm *PPM) error {
+	if ppm.magicNumber != "P3" && ppm.magicNumber != "P6" {
+		return fmt.Errorf("%w: %q is not a PPM magic number", ErrBadMagic, ppm.magicNumber)
+	}
+	if err := checkDimensions(ppm.width, ppm.height, 3); err != nil {
+		return err
+	}
+	if ppm.max == 0 {
+		return ErrInvalidMaxValue
+	}
+
+	logger().Debug("netpbm: writing PPM", "magicNumber", ppm.magicNumber, "width", ppm.width, "height", ppm.height,
+		"bytesPerSample", bytesPerSample(ppm.max))
+	writer := bufio.NewWriter(w)
+
+	// Write the PPM header
+	_, err := fmt.Fprintf(writer, "%s\n%d %d\n%d\n", ppm.magicNumber, ppm.width, ppm.height, ppm.max)
 	if err != nil {
 		return err
 	}
 
-	// Write pixel data to the file
+	// Write raw pixel data, three samples per pixel
+	if ppm.magicNumber == "P6" {
+		raw := make([]byte, 3*ppm.width*bytesPerSample(ppm.max))
+		for i := 0; i < ppm.height; i++ {
+			writeSamples(raw, ppm.row(i), ppm.max)
+			if _, err := writer.Write(raw); err != nil {
+				return err
+			}
+		}
+		return writer.Flush()
+	}
+
+	// Write pixel data
 	for i := 0; i < ppm.height; i++ {
-		for j := 0; j < ppm.width; j++ {
-			pixel := ppm.data[i][j]
-			_, err := fmt.Fprintf(file, "%d %d %d ", pixel.R, pixel.G, pixel.B)
+		row := ppm.row(i)
+		for j := 0; j < len(row); j += 3 {
+			_, err := fmt.Fprintf(writer, "%d %d %d ", row[j], row[j+1], row[j+2])
 			if err != nil {
 				return err
 			}
 		}
-		_, err := fmt.Fprintln(file) // New line after each row of pixels
+		_, err := fmt.Fprintln(writer) // New line after each row of pixels
 		if err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return writer.Flush()
+}
+
+// MaxValue returns the maximum color value of the PPM image.
+func (ppm *PPM) MaxValue() uint16 {
+	return ppm.max
+}
+
+// Is16Bit reports whether the PPM image uses 16-bit samples, that is whether its
+// maximum color value is above 255.
+func (ppm *PPM) Is16Bit() bool {
+	return ppm.max > 255
 }
 
 // Invert inverts the colors of the PPM image.
 func (ppm *PPM) Invert() {
 	for i := 0; i < ppm.height; i++ {
-		for j := 0; j < ppm.width; j++ {
-			pixel := ppm.data[i][j]
-			invertedPixel := Pixel{
-				R: ppm.max - pixel.R,
-				G: ppm.max - pixel.G,
-				B: ppm.max - pixel.B,
-			}
-			ppm.data[i][j] = invertedPixel
+		row := ppm.row(i)
+		for j := range row {
+			row[j] = ppm.max - row[j]
 		}
 	}
 }
@@ -165,16 +377,22 @@ func (ppm *PPM) Invert() {
 // Flip flips the PPM image horizontally.
 func (ppm *PPM) Flip() {
 	for i := 0; i < ppm.height; i++ {
-		for j, k := 0, ppm.width-1; j < k; j, k = j+1, k-1 {
-			ppm.data[i][j], ppm.data[i][k] = ppm.data[i][k], ppm.data[i][j]
+		row := ppm.row(i)
+		for j, k := 0, 3*(ppm.width-1); j < k; j, k = j+3, k-3 {
+			row[j], row[k] = row[k], row[j]
+			row[j+1], row[k+1] = row[k+1], row[j+1]
+			row[j+2], row[k+2] = row[k+2], row[j+2]
 		}
 	}
 }
 
 // Flop flips the PPM image vertically.
 func (ppm *PPM) Flop() {
+	tmp := make([]uint16, 3*ppm.width)
 	for i, j := 0, ppm.height-1; i < j; i, j = i+1, j-1 {
-		ppm.data[i], ppm.data[j] = ppm.data[j], ppm.data[i]
+		copy(tmp, ppm.row(i))
+		copy(ppm.row(i), ppm.row(j))
+		copy(ppm.row(j), tmp)
 	}
 }
 
@@ -183,11 +401,12 @@ func (ppm *PPM) SetMagicNumber(magicNumber string) {
 	ppm.magicNumber = magicNumber
 }
 
-// SetMaxValue sets the maximum color value of the PPM image.
-func (ppm *PPM) SetMaxValue(maxValue uint8) {
-	// Check if the new maximum value is different from the current value
-	if maxValue == ppm.max {
-		return // No need to make changes if the maximum value is the same
+// SetMaxValue sets the maximum color value of the PPM image. A maximum value
+// of 0 cannot be encoded and would lose every pixel, so it is ignored.
+func (ppm *PPM) SetMaxValue(maxValue uint16) {
+	// Nothing changes for the same maximum value, and 0 is not a valid one
+	if maxValue == ppm.max || maxValue == 0 {
+		return
 	}
 
 	// Calculate the proportionality factor to adjust pixel values
@@ -195,14 +414,9 @@ func (ppm *PPM) SetMaxValue(maxValue uint8) {
 
 	// Adjust pixel data based on the new maximum value
 	for i := 0; i < ppm.height; i++ {
-		for j := 0; j < ppm.width; j++ {
-			pixel := ppm.data[i][j]
-			adjustedPixel := Pixel{
-				R: uint8(float64(pixel.R) * scaleFactor),
-				G: uint8(float64(pixel.G) * scaleFactor),
-				B: uint8(float64(pixel.B) * scaleFactor),
-			}
-			ppm.data[i][j] = adjustedPixel
+		row := ppm.row(i)
+		for j := range row {
+			row[j] = uint16(float64(row[j]) * scaleFactor)
 		}
 	}
 
@@ -212,86 +426,42 @@ func (ppm *PPM) SetMaxValue(maxValue uint8) {
 
 // Rotate90CW rotates the PPM image 90 degrees clockwise.
 func (ppm *PPM) Rotate90CW() {
-	// Create a new matrix to store the rotated pixels
-	rotatedData := make([][]Pixel, ppm.width)
-	for i := range rotatedData {
-		rotatedData[i] = make([]Pixel, ppm.height)
-	}
-
-	// Fill the new matrix with the rotated pixels
-	for i := 0; i < ppm.height; i++ {
-		for j := 0; j < ppm.width; j++ {
-			rotatedData[j][ppm.height-i-1] = ppm.data[i][j]
-		}
-	}
-
-	// Update the image data with the rotated pixels
-	ppm.data = rotatedData
-
-	// Update the image dimensions (width and height)
-	ppm.width, ppm.height = ppm.height, ppm.width
+	ppm.reorient(rotate90CW)
 }
 
-// ToPGM converts the PPM image to a PGM image.
-func (ppm *PPM) ToPGM() *PGM {
-	// Create a new matrix for PGM data
-	pgmData := make([][]uint8, ppm.height)
-	for i := range pgmData {
-		pgmData[i] = make([]uint8, ppm.width)
+// ToPGM converts the PPM image to a PGM image. By default the gray level is
+// the average of the components; opts, of which at most one is used, selects
+// other weightings.
+func (ppm *PPM) ToPGM(opts ...GrayOptions) *PGM {
+	var o GrayOptions
+	if len(opts) > 0 {
+		o = opts[0]
 	}
+	toGray := o.grayFunc(ppm.max)
+
+	// Create a new PGM image with the same dimensions
+	pgm := newPGM(ppm.width, ppm.height, "P2", ppm.max)
 
 	// Convert PPM pixels to PGM grayscale levels
 	for i := 0; i < ppm.height; i++ {
-		for j := 0; j < ppm.width; j++ {
-			pixel := ppm.data[i][j]
-			averageValue := uint8((uint32(pixel.R) + uint32(pixel.G) + uint32(pixel.B)) / 3)
-			pgmData[i][j] = averageValue
+		row, gray := ppm.row(i), pgm.row(i)
+		for j := range gray {
+			gray[j] = toGray(row[3*j], row[3*j+1], row[3*j+2])
 		}
 	}
 
-	// Create a new instance of the PGM structure
-	pgm := &PGM{
-		data:        pgmData,
-		width:       ppm.width,
-		height:      ppm.height,
-		magicNumber: "P2",
-		max:         ppm.max,
-	}
-
 	return pgm
 }
 
-// ToPBM converts the PPM image to a PBM image.
-func (ppm *PPM) ToPBM() *PBM {
-	// Convert the PPM image to PGM
-	pgm := ppm.ToPGM()
-
-	// Convert the PGM image to PBM
-	var data [][]bool
-	data = make([][]bool, pgm.height)
-	for i := range data {
-		data[i] = make([]bool, pgm.width)
+// ToPBM converts the PPM image to a PBM image, turned to gray according to
+// the Gray field of opts and dithered as PGM.ToPBM does.
+func (ppm *PPM) ToPBM(opts ...DitherOptions) *PBM {
+	// Convert the PPM image to PGM, then the PGM image to PBM
+	var gray GrayOptions
+	if len(opts) > 0 {
+		gray = opts[0].Gray
 	}
-
-	for i := 0; i < pgm.height; i++ {
-		for j := 0; j < pgm.width; j++ {
-			if pgm.data[i][j] > pgm.max/2 {
-				data[i][j] = true
-			} else {
-				data[i][j] = false
-			}
-		}
-	}
-
-	// Create a new instance of the PBM structure
-	pbm := &PBM{
-		data:        data,
-		width:       pgm.width,
-		height:      pgm.height,
-		magicNumber: "P1",
-	}
-
-	return pbm
+	return ppm.ToPGM(gray).ToPBM(opts...)
 }
 
 func (ppm *PPM) DrawLine(p1, p2 Point, color Pixel) {
@@ -335,7 +505,7 @@ func (ppm *PPM) DrawLine(p1, p2 Point, color Pixel) {
 	for {
 		// Check if the current point is within the image bounds
 		if p1.X >= 0 && p1.X < ppm.width && p1.Y >= 0 && p1.Y < ppm.height {
-			ppm.data[p1.Y][p1.X] = color
+			ppm.SetPixel(p1.X, p1.Y, color)
 		}
 
 		if p1.X == p2.X && p1.Y == p2.Y {
@@ -399,7 +569,7 @@ func (ppm *PPM) DrawFilledRectangle(p1 Point, width, height int, color Pixel) {
 		var positions []int
 		var numberPoints int
 		for j := 0; j < ppm.width; j++ {
-			if ppm.data[i][j] == color {
+			if ppm.PixelAt(j, i) == color {
 				numberPoints += 1
 				positions = append(positions, j)
 			}
@@ -407,14 +577,14 @@ func (ppm *PPM) DrawFilledRectangle(p1 Point, width, height int, color Pixel) {
 		if numberPoints > 1 {
 			// Fill the pixels between the first and last points in the row
 			for k := positions[0] + 1; k < positions[len(positions)-1]; k++ {
-				ppm.data[i][k] = color
+				ppm.SetPixel(k, i, color)
 			}
 		}
 		// Handle the case where the rectangle exceeds image dimensions
 		if height > ppm.height && width > ppm.width {
 			// Fill the entire row if the rectangle is larger than the image
 			for k := 0; k < ppm.width; k++ {
-				ppm.data[i][k] = color
+				ppm.SetPixel(k, i, color)
 			}
 		}
 	}
@@ -422,23 +592,23 @@ func (ppm *PPM) DrawFilledRectangle(p1 Point, width, height int, color Pixel) {
 
 func (ppm *PPM) DrawCircle(center Point, radius int, color Pixel) {
 	// Draw the circumference of the circle
-	for x := 0; x < ppm.height; x++ {
-		for y := 0; y < ppm.width; y++ {
+	for y := 0; y < ppm.height; y++ {
+		for x := 0; x < ppm.width; x++ {
 			dx := float64(x) - float64(center.X)
 			dy := float64(y) - float64(center.Y)
 			distance := math.Sqrt(dx*dx + dy*dy)
 
 			// Check if the current pixel is on the circumference
 			if math.Abs(distance-float64(radius)) < 1.0 && distance < float64(radius) {
-				ppm.Set(x, y, color)
+				ppm.SetPixel(x, y, color)
 			}
 		}
 	}
-	// Draw additional points on the axes to complete the circle
-	ppm.Set(center.X-(radius-1), center.Y, color)
-	ppm.Set(center.X+(radius-1), center.Y, color)
-	ppm.Set(center.X, center.Y+(radius-1), color)
-	ppm.Set(center.X, center.Y-(radius-1), color)
+	// Draw additional points on the axes to complete the circle, skipping those outside the image
+	ppm.SetPixelChecked(center.X-(radius-1), center.Y, color)
+	ppm.SetPixelChecked(center.X+(radius-1), center.Y, color)
+	ppm.SetPixelChecked(center.X, center.Y+(radius-1), color)
+	ppm.SetPixelChecked(center.X, center.Y-(radius-1), color)
 }
 
 func (ppm *PPM) DrawFilledCircle(center Point, radius int, color Pixel) {
@@ -450,14 +620,14 @@ func (ppm *PPM) DrawFilledCircle(center Point, radius int, color Pixel) {
 		var positions []int
 		var numberPoints int
 		for j := 0; j < ppm.width; j++ {
-			if ppm.data[i][j] == color {
+			if ppm.PixelAt(j, i) == color {
 				numberPoints += 1
 				positions = append(positions, j)
 			}
 		}
 		if numberPoints > 1 {
 			for k := positions[0] + 1; k < positions[len(positions)-1]; k++ {
-				ppm.data[i][k] = color
+				ppm.SetPixel(k, i, color)
 			}
 		}
 	}
@@ -479,14 +649,14 @@ func (ppm *PPM) DrawFilledTriangle(p1, p2, p3 Point, color Pixel) {
 		var positions []int
 		var numberPoints int
 		for j := 0; j < ppm.width; j++ {
-			if ppm.data[i][j] == color {
+			if ppm.PixelAt(j, i) == color {
 				numberPoints += 1
 				positions = append(positions, j)
 			}
 		}
 		if numberPoints > 1 {
 			for k := positions[0] + 1; k < positions[len(positions)-1]; k++ {
-				ppm.data[i][k] = color
+				ppm.SetPixel(k, i, color)
 			}
 		}
 	}
@@ -517,14 +687,14 @@ func (ppm *PPM) DrawFilledPolygon(points []Point, color Pixel) {
 		var positions []int
 		var numberPoints int
 		for j := 0; j < ppm.width; j++ {
-			if ppm.data[i][j] == color {
+			if ppm.PixelAt(j, i) == color {
 				numberPoints += 1
 				positions = append(positions, j)
 			}
 		}
 		if numberPoints > 1 {
 			for k := positions[0] + 1; k < positions[len(positions)-1]; k++ {
-				ppm.data[i][k] = color
+				ppm.SetPixel(k, i, color)
 			}
 		}
 	}
@@ -541,9 +711,9 @@ func (ppm *PPM) DrawPerlinNoise(color1 Pixel, color2 Pixel) {
 	// Function to perform linear interpolation between two colors
 	lerpColor := func(color1 Pixel, color2 Pixel, t float64) Pixel {
 		clampedT := math.Max(0, math.Min(1, t))
-		r := uint8(float64(color1.R)*(1-clampedT) + float64(color2.R)*clampedT)
-		g := uint8(float64(color1.G)*(1-clampedT) + float64(color2.G)*clampedT)
-		b := uint8(float64(color1.B)*(1-clampedT) + float64(color2.B)*clampedT)
+		r := uint16(float64(color1.R)*(1-clampedT) + float64(color2.R)*clampedT)
+		g := uint16(float64(color1.G)*(1-clampedT) + float64(color2.G)*clampedT)
+		b := uint16(float64(color1.B)*(1-clampedT) + float64(color2.B)*clampedT)
 		return Pixel{r, g, b}
 	}
 
@@ -557,7 +727,7 @@ func (ppm *PPM) DrawPerlinNoise(color1 Pixel, color2 Pixel) {
 			lerpedColor := lerpColor(color1, color2, (noiseValue+1)/2)
 
 			// Set the pixel color in the image
-			ppm.Set(x, y, lerpedColor)
+			ppm.SetPixel(x, y, lerpedColor)
 		}
 	}
 }
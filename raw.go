@@ -0,0 +1,70 @@
+package Netpbm
+
+import "slices"
+
+// rasterChunk is the most samples a decoder allocates ahead of the data it
+// has read, so that a header claiming a huge image cannot make it allocate
+// much more memory than the stream actually holds.
+const rasterChunk = 1 << 16
+
+// readRaster appends n samples to pix, filling at most rasterChunk of them
+// at a time with read, and returns the extended buffer.
+func readRaster[T uint8 | uint16](pix []T, n int, read func(dst []T) error) ([]T, error) {
+	for n > 0 {
+		k := min(n, rasterChunk)
+		pix = slices.Grow(pix, k)[:len(pix)+k]
+		if err := read(pix[len(pix)-k:]); err != nil {
+			return nil, err
+		}
+		n -= k
+	}
+	return pix, nil
+}
+
+// bytesPerSample returns how many bytes a raw (P5, P6) sample occupies for
+// the given maximum value: one byte up to 255, two big-endian bytes above.
+func bytesPerSample(max uint16) int {
+	if max > 255 {
+		return 2
+	}
+	return 1
+}
+
+// readSamples reads len(dst) raw samples, using buf, which must hold at least
+// len(dst)*bytesPerSample(max) bytes, as scratch space. A sample above max is
+// reported as an ErrInvalidSample *ParseError, as plain samples are.
+func (h *tokenReader) readSamples(dst []uint16, buf []byte, max uint16) error {
+	size := bytesPerSample(max)
+	buf = buf[:len(dst)*size]
+	if err := h.readFull(buf); err != nil {
+		return err
+	}
+
+	for i := range dst {
+		if size == 1 {
+			dst[i] = uint16(buf[i])
+		} else {
+			dst[i] = uint16(buf[2*i])<<8 | uint16(buf[2*i+1])
+		}
+		if dst[i] > max {
+			err := h.errorf(ErrInvalidSample, "sample %d exceeds maximum value %d", dst[i], max).(*ParseError)
+			err.Offset -= int64(len(buf) - i*size)
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSamples encodes src as raw samples into buf.
+func writeSamples(buf []byte, src []uint16, max uint16) {
+	if bytesPerSample(max) == 1 {
+		for i, v := range src {
+			buf[i] = uint8(v)
+		}
+		return
+	}
+	for i, v := range src {
+		buf[2*i] = uint8(v >> 8)
+		buf[2*i+1] = uint8(v)
+	}
+}
@@ -0,0 +1,156 @@
+package Netpbm
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestPlainRasterLayout(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []uint8
+	}{
+		{"one row per line", "P1 3 2\n1 0 1\n0 1 0\n", []uint8{1, 0, 1, 0, 1, 0}},
+		{"packed digits", "P1 3 2\n101010\n", []uint8{1, 0, 1, 0, 1, 0}},
+		{"packed digits on one line", "P1 3 2 101010", []uint8{1, 0, 1, 0, 1, 0}},
+		{"wrapped rows", "P1 3 2\n1 0\n1 0 1\n0\n", []uint8{1, 0, 1, 0, 1, 0}},
+		{"comments between pixels", "P1 3 2\n10# row 1\n1\n#\n010", []uint8{1, 0, 1, 0, 1, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pbm, err := DecodePBM(strings.NewReader(tt.input))
+			if err != nil {
+				t.Fatalf("DecodePBM: %v", err)
+			}
+			if !bytes.Equal(pbm.Pix(), tt.want) {
+				t.Errorf("pixels = %v, want %v", pbm.Pix(), tt.want)
+			}
+		})
+	}
+
+	ppm, err := DecodePPM(strings.NewReader("P3 2 1 65535\n65535 0\n1 2 # blue\n3\n40000"))
+	if err != nil {
+		t.Fatalf("DecodePPM: %v", err)
+	}
+	want := []uint16{65535, 0, 1, 2, 3, 40000}
+	if !slices.Equal(ppm.Pix(), want) {
+		t.Errorf("PPM samples = %v, want %v", ppm.Pix(), want)
+	}
+}
+
+func TestRawPBMRoundTrip(t *testing.T) {
+	for _, width := range []int{1, 7, 8, 9, 13, 17, 70000} {
+		pbm, err := NewPBM(width, 3, "P4")
+		if err != nil {
+			t.Fatal(err)
+		}
+		// A diagonal plus the last column, which falls in the padding byte
+		for y := 0; y < 3; y++ {
+			pbm.SetBit(min(y, width-1), y, true)
+			pbm.SetBit(width-1, y, y != 1)
+		}
+
+		var buf bytes.Buffer
+		if err := EncodePBM(&buf, pbm); err != nil {
+			t.Fatalf("width %d: EncodePBM: %v", width, err)
+		}
+		got, err := DecodePBM(&buf)
+		if err != nil {
+			t.Fatalf("width %d: DecodePBM: %v", width, err)
+		}
+		if !got.Equal(pbm) {
+			t.Errorf("width %d: round trip changed the image", width)
+		}
+	}
+}
+
+func TestRaw16BitRoundTrip(t *testing.T) {
+	for _, max := range []uint16{256, 1000, 65535} {
+		pgm, err := NewPGM(300, 250, "P5", max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ppm, err := NewPPM(300, 250, "P6", max)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for y := 0; y < 250; y++ {
+			for x := 0; x < 300; x++ {
+				v := uint16((x*251 + y*65521) % (int(max) + 1))
+				pgm.SetGray(x, y, v)
+				ppm.SetPixel(x, y, Pixel{v, max - v, v / 2})
+			}
+		}
+
+		var buf bytes.Buffer
+		if err := EncodePGM(&buf, pgm); err != nil {
+			t.Fatalf("max %d: EncodePGM: %v", max, err)
+		}
+		gotPGM, err := DecodePGM(&buf)
+		if err != nil {
+			t.Fatalf("max %d: DecodePGM: %v", max, err)
+		}
+		if !gotPGM.Equal(pgm) {
+			t.Errorf("max %d: PGM round trip changed the image", max)
+		}
+
+		buf.Reset()
+		if err := EncodePPM(&buf, ppm); err != nil {
+			t.Fatalf("max %d: EncodePPM: %v", max, err)
+		}
+		gotPPM, err := DecodePPM(&buf)
+		if err != nil {
+			t.Fatalf("max %d: DecodePPM: %v", max, err)
+		}
+		if !gotPPM.Equal(ppm) {
+			t.Errorf("max %d: PPM round trip changed the image", max)
+		}
+	}
+}
+
+func TestRawSampleAboveMax(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		offset int64
+	}{
+		{"8-bit P5", "P5 2 1 100\n\x10\xc8", 12},
+		{"16-bit P5", "P5 2 1 1000\n\x00\x10\x03\xe9", 14},
+		{"P6", "P6 2 1 200\n\x00\x00\x00\x00\xc9\x00", 15},
+		{"P7", "P7\nWIDTH 1\nHEIGHT 1\nDEPTH 2\nMAXVAL 9\nENDHDR\n\x09\x0a", 45},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode(strings.NewReader(tt.input))
+			var perr *ParseError
+			if !errors.As(err, &perr) || !errors.Is(err, ErrInvalidSample) {
+				t.Fatalf("Decode error = %v, want a *ParseError wrapping ErrInvalidSample", err)
+			}
+			if perr.Offset != tt.offset {
+				t.Errorf("error at offset %d, want %d", perr.Offset, tt.offset)
+			}
+		})
+	}
+}
+
+func TestEncodeEmpty(t *testing.T) {
+	pbm, _ := NewPBM(2, 2, "P4")
+	pgm, _ := NewPGM(2, 2, "P5", 255)
+	ppm, _ := NewPPM(2, 2, "P6", 255)
+	empty := image.Rect(1, 1, 1, 2)
+	images := []Image{pbm.SubImage(empty), pgm.SubImage(empty), ppm.SubImage(empty), ppm.ToPAM().SubImage(empty)}
+	for _, img := range images {
+		var buf bytes.Buffer
+		if err := Encode(&buf, img); !errors.Is(err, ErrInvalidHeader) {
+			t.Errorf("Encode(%T) error = %v, want %v", img, err, ErrInvalidHeader)
+		}
+		if buf.Len() != 0 {
+			t.Errorf("Encode(%T) wrote %q", img, buf.String())
+		}
+	}
+}
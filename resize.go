@@ -0,0 +1,229 @@
+package Netpbm
+
+import (
+	"fmt"
+	"math"
+)
+
+// Filter selects the resampling kernel used by Resize.
+type Filter int
+
+// Resampling filters, from fastest to sharpest.
+const (
+	// NearestNeighbor copies the closest source pixel. It keeps hard edges and
+	// never invents new values.
+	NearestNeighbor Filter = iota
+	// Box averages the source pixels covered by each destination pixel. It is
+	// the usual choice for downscaling by large factors.
+	Box
+	// Bilinear interpolates linearly between the 2x2 nearest source pixels.
+	Bilinear
+	// Bicubic uses the Catmull-Rom cubic over the 4x4 nearest source pixels.
+	Bicubic
+	// Lanczos uses the 3-lobed Lanczos windowed sinc over 6x6 source pixels.
+	Lanczos
+)
+
+// check returns an error if the filter is not one of the defined filters.
+func (f Filter) check() error {
+	if f < NearestNeighbor || f > Lanczos {
+		return fmt.Errorf("netpbm: unknown resampling filter %d", f)
+	}
+	return nil
+}
+
+// support returns the radius of the kernel, in source pixels at scale 1.
+func (f Filter) support() float64 {
+	switch f {
+	case Box:
+		return 0.5
+	case Bilinear:
+		return 1
+	case Bicubic:
+		return 2
+	case Lanczos:
+		return 3
+	}
+	return 0
+}
+
+// kernel returns the weight of a source pixel at distance x from the sample point.
+func (f Filter) kernel(x float64) float64 {
+	x = math.Abs(x)
+	switch f {
+	case Box:
+		if x <= 0.5 {
+			return 1
+		}
+	case Bilinear:
+		if x < 1 {
+			return 1 - x
+		}
+	case Bicubic:
+		// Catmull-Rom, the cubic convolution kernel with a = -0.5
+		if x < 1 {
+			return (1.5*x-2.5)*x*x + 1
+		}
+		if x < 2 {
+			return ((-0.5*x+2.5)*x-4)*x + 2
+		}
+	case Lanczos:
+		if x == 0 {
+			return 1
+		}
+		if x < 3 {
+			return 3 * math.Sin(math.Pi*x) * math.Sin(math.Pi*x/3) / (math.Pi * math.Pi * x * x)
+		}
+	}
+	return 0
+}
+
+// tap is the weight of one source pixel in a destination pixel.
+type tap struct {
+	index  int
+	weight float64
+}
+
+// taps returns, for each of the dst destination pixels along one axis, the
+// source pixels among src that contribute to it. When downscaling the kernel
+// is stretched to cover every source pixel, which avoids aliasing.
+func (f Filter) taps(src, dst int) [][]tap {
+	scale := float64(src) / float64(dst)
+	filterScale := math.Max(scale, 1)
+	radius := f.support() * filterScale
+
+	taps := make([][]tap, dst)
+	for i := range taps {
+		center := (float64(i) + 0.5) * scale
+		if f == NearestNeighbor {
+			taps[i] = []tap{{min(int(center), src-1), 1}}
+			continue
+		}
+
+		var sum float64
+		for j := int(math.Floor(center - radius)); j <= int(math.Ceil(center+radius)); j++ {
+			w := f.kernel((float64(j) + 0.5 - center) / filterScale)
+			if w == 0 {
+				continue
+			}
+			// Pixels past the edges repeat the edge pixel
+			taps[i] = append(taps[i], tap{min(max(j, 0), src-1), w})
+			sum += w
+		}
+		for k := range taps[i] {
+			taps[i][k].weight /= sum
+		}
+	}
+	return taps
+}
+
+// tapSpan returns the lowest and highest source indexes among taps.
+func tapSpan(taps []tap) (lo, hi int) {
+	lo, hi = taps[0].index, taps[0].index
+	for _, t := range taps[1:] {
+		lo, hi = min(lo, t.index), max(hi, t.index)
+	}
+	return lo, hi
+}
+
+// resample scales an image of size (sw, sh) to (dw, dh) with the filter.
+// Rows are read through src and written through dst, n samples per pixel.
+// Results are rounded and clamped to 0..maxValue.
+func resample[T uint8 | uint16](src func(y int) []T, sw, sh int, dst func(y int) []T, dw, dh int, n int, maxValue T, filter Filter) {
+	// Scale rows horizontally as the vertical taps reach them, then combine
+	// them vertically. The rows spanned by the taps of one destination row
+	// only move down, so a ring of that many scaled rows is enough.
+	xTaps, yTaps := filter.taps(sw, dw), filter.taps(sh, dh)
+	window := 1
+	for _, taps := range yTaps {
+		lo, hi := tapSpan(taps)
+		window = max(window, hi-lo+1)
+	}
+	ring := make([]float64, window*dw*n)
+	scaled := func(y int) []float64 {
+		i := y % window
+		return ring[i*dw*n : (i+1)*dw*n]
+	}
+
+	acc := make([]float64, dw*n)
+	next := 0
+	for y, taps := range yTaps {
+		lo, hi := tapSpan(taps)
+		for next = max(next, lo); next <= hi; next++ {
+			row, out := src(next), scaled(next)
+			for i := range out {
+				out[i] = 0
+			}
+			for x, taps := range xTaps {
+				for _, t := range taps {
+					for c := 0; c < n; c++ {
+						out[x*n+c] += t.weight * float64(row[t.index*n+c])
+					}
+				}
+			}
+		}
+
+		for i := range acc {
+			acc[i] = 0
+		}
+		for _, t := range taps {
+			for i, v := range scaled(t.index) {
+				acc[i] += t.weight * v
+			}
+		}
+		out := dst(y)
+		for i, v := range acc {
+			out[i] = T(math.Min(math.Max(v+0.5, 0), float64(maxValue)))
+		}
+	}
+}
+
+// checkResize returns an error if the source is empty, or if the size or
+// filter given to Resize is invalid.
+func checkResize(srcWidth, srcHeight, width, height, samples int, filter Filter) error {
+	if err := checkSource(srcWidth, srcHeight); err != nil {
+		return err
+	}
+	if err := checkDimensions(width, height, samples); err != nil {
+		return err
+	}
+	return filter.check()
+}
+
+// Resize scales the image to width x height pixels with the filter.
+// Every filter but NearestNeighbor scales the image as gray levels and then
+// thresholds the result at half, which keeps thin lines and smooths edges.
+func (pbm *PBM) Resize(width, height int, filter Filter) error {
+	if err := checkResize(pbm.width, pbm.height, width, height, 1, filter); err != nil {
+		return err
+	}
+
+	resized := newPBM(width, height, pbm.magicNumber)
+	resample(pbm.row, pbm.width, pbm.height, resized.row, width, height, 1, 1, filter)
+	*pbm = *resized
+	return nil
+}
+
+// Resize scales the image to width x height pixels with the filter.
+func (pgm *PGM) Resize(width, height int, filter Filter) error {
+	if err := checkResize(pgm.width, pgm.height, width, height, 1, filter); err != nil {
+		return err
+	}
+
+	resized := newPGM(width, height, pgm.magicNumber, pgm.max)
+	resample(pgm.row, pgm.width, pgm.height, resized.row, width, height, 1, pgm.max, filter)
+	*pgm = *resized
+	return nil
+}
+
+// Resize scales the image to width x height pixels with the filter.
+func (ppm *PPM) Resize(width, height int, filter Filter) error {
+	if err := checkResize(ppm.width, ppm.height, width, height, 3, filter); err != nil {
+		return err
+	}
+
+	resized := newPPM(width, height, ppm.magicNumber, ppm.max)
+	resample(ppm.row, ppm.width, ppm.height, resized.row, width, height, 3, ppm.max, filter)
+	*ppm = *resized
+	return nil
+}
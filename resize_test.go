@@ -0,0 +1,167 @@
+package Netpbm
+
+import (
+	"image"
+	"slices"
+	"testing"
+)
+
+var filters = []struct {
+	name   string
+	filter Filter
+}{
+	{"NearestNeighbor", NearestNeighbor},
+	{"Box", Box},
+	{"Bilinear", Bilinear},
+	{"Bicubic", Bicubic},
+	{"Lanczos", Lanczos},
+}
+
+// patternPGM returns a width x height PGM image whose samples all differ
+// from their neighbors.
+func patternPGM(t *testing.T, width, height int, max uint16) *PGM {
+	t.Helper()
+	pgm, err := NewPGM(width, height, "P5", max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			pgm.SetGray(x, y, uint16((x*37+y*101)%(int(max)+1)))
+		}
+	}
+	return pgm
+}
+
+// patternPPM returns a width x height PPM image whose samples all differ
+// from their neighbors.
+func patternPPM(t *testing.T, width, height int, max uint16) *PPM {
+	t.Helper()
+	ppm, err := NewPPM(width, height, "P6", max)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := int(max) + 1
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			ppm.SetPixel(x, y, Pixel{uint16((x*37 + y*101) % m), uint16((x*53 + y*7) % m), uint16((x*x + y) % m)})
+		}
+	}
+	return ppm
+}
+
+func TestResizeIdentity(t *testing.T) {
+	for _, f := range filters {
+		t.Run(f.name, func(t *testing.T) {
+			pgm := patternPGM(t, 7, 5, 1000)
+			got := pgm.Clone()
+			if err := got.Resize(7, 5, f.filter); err != nil {
+				t.Fatalf("PGM.Resize: %v", err)
+			}
+			if !got.Equal(pgm) {
+				t.Errorf("PGM.Resize to the same size changed the image: %v, want %v", got.Pix(), pgm.Pix())
+			}
+
+			ppm := patternPPM(t, 7, 5, 255)
+			gotPPM := ppm.Clone()
+			if err := gotPPM.Resize(7, 5, f.filter); err != nil {
+				t.Fatalf("PPM.Resize: %v", err)
+			}
+			if !gotPPM.Equal(ppm) {
+				t.Errorf("PPM.Resize to the same size changed the image")
+			}
+
+			pbm := pgm.ToPBM()
+			gotPBM := pbm.Clone()
+			if err := gotPBM.Resize(7, 5, f.filter); err != nil {
+				t.Fatalf("PBM.Resize: %v", err)
+			}
+			if !gotPBM.Equal(pbm) {
+				t.Errorf("PBM.Resize to the same size changed the image")
+			}
+		})
+	}
+}
+
+func TestResizeBoxHalves(t *testing.T) {
+	pgm := patternPGM(t, 8, 6, 255)
+	want := make([]uint16, 0, 4*3)
+	for y := 0; y < 6; y += 2 {
+		for x := 0; x < 8; x += 2 {
+			sum := pgm.GrayAt(x, y) + pgm.GrayAt(x+1, y) + pgm.GrayAt(x, y+1) + pgm.GrayAt(x+1, y+1)
+			// Round half up, as resample does
+			want = append(want, (sum+2)/4)
+		}
+	}
+
+	if err := pgm.Resize(4, 3, Box); err != nil {
+		t.Fatalf("Resize: %v", err)
+	}
+	if !slices.Equal(pgm.Pix(), want) {
+		t.Errorf("Resize = %v, want %v", pgm.Pix(), want)
+	}
+}
+
+func TestResizeSizes(t *testing.T) {
+	// Large changes in both directions exercise the window of scaled rows
+	for _, f := range filters {
+		for _, size := range [][2]int{{1, 1}, {3, 40}, {40, 3}, {29, 31}} {
+			ppm := patternPPM(t, 13, 11, 65535)
+			if err := ppm.Resize(size[0], size[1], f.filter); err != nil {
+				t.Fatalf("%s to %v: %v", f.name, size, err)
+			}
+			if w, h := ppm.Size(); w != size[0] || h != size[1] || len(ppm.Pix()) != 3*w*h {
+				t.Errorf("%s to %v: got %dx%d with %d samples", f.name, size, w, h, len(ppm.Pix()))
+			}
+		}
+	}
+
+	// A flat image stays flat whatever the filter
+	for _, f := range filters {
+		pgm, _ := NewPGM(5, 4, "P2", 255, 77)
+		if err := pgm.Resize(11, 3, f.filter); err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range pgm.Pix() {
+			if v != 77 {
+				t.Errorf("%s: flat image resized to %v", f.name, pgm.Pix())
+				break
+			}
+		}
+	}
+}
+
+func TestResizeErrors(t *testing.T) {
+	pgm := patternPGM(t, 4, 4, 255)
+	tests := []struct {
+		name          string
+		img           *PGM
+		width, height int
+		filter        Filter
+	}{
+		{"zero width", pgm, 0, 4, Box},
+		{"negative height", pgm, 4, -1, Box},
+		{"unknown filter", pgm, 2, 2, Lanczos + 1},
+		{"empty source", pgm.SubImage(image.Rect(1, 1, 1, 3)), 2, 2, Bilinear},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := tt.img.Clone()
+			if err := tt.img.Resize(tt.width, tt.height, tt.filter); err == nil {
+				t.Fatal("Resize succeeded")
+			}
+			if !tt.img.Equal(before) {
+				t.Error("failed Resize changed the image")
+			}
+		})
+	}
+
+	ppm := patternPPM(t, 4, 4, 255).SubImage(image.Rectangle{})
+	if err := ppm.Resize(2, 2, Lanczos); err == nil {
+		t.Error("PPM.Resize of an empty image succeeded")
+	}
+	pbm, _ := NewPBM(4, 4, "P1")
+	if err := pbm.SubImage(image.Rect(0, 2, 4, 2)).Resize(2, 2, NearestNeighbor); err == nil {
+		t.Error("PBM.Resize of an empty image succeeded")
+	}
+}
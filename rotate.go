@@ -0,0 +1,309 @@
+package Netpbm
+
+import (
+	"image/color"
+	"math"
+)
+
+// orientation is a lossless rearrangement of the pixels of an image.
+type orientation int
+
+const (
+	rotate90CW orientation = iota
+	rotate90CCW
+	rotate180
+	transpose
+	transverse
+)
+
+// swapsAxes reports whether the orientation swaps the width and height.
+func (o orientation) swapsAxes() bool {
+	return o != rotate180
+}
+
+// source returns the pixel of a sw x sh source image that ends up at (x, y).
+func (o orientation) source(x, y, sw, sh int) (int, int) {
+	switch o {
+	case rotate90CW:
+		return y, sh - 1 - x
+	case rotate90CCW:
+		return sw - 1 - y, x
+	case rotate180:
+		return sw - 1 - x, sh - 1 - y
+	case transpose:
+		return y, x
+	}
+	return sw - 1 - y, sh - 1 - x
+}
+
+// reorient copies the pixels of an image of size (sw, sh) into dst, rearranged
+// by the orientation. n is the number of samples per pixel.
+func reorient[T any](src func(y int) []T, sw, sh int, dst func(y int) []T, n int, o orientation) {
+	dw, dh := sw, sh
+	if o.swapsAxes() {
+		dw, dh = sh, sw
+	}
+	for y := 0; y < dh; y++ {
+		out := dst(y)
+		for x := 0; x < dw; x++ {
+			sx, sy := o.source(x, y, sw, sh)
+			copy(out[x*n:(x+1)*n], src(sy)[sx*n:(sx+1)*n])
+		}
+	}
+}
+
+// reorient rearranges the pixels of the image by the orientation.
+func (pbm *PBM) reorient(o orientation) {
+	w, h := pbm.width, pbm.height
+	if o.swapsAxes() {
+		w, h = h, w
+	}
+	dst := newPBM(w, h, pbm.magicNumber)
+	reorient(pbm.row, pbm.width, pbm.height, dst.row, 1, o)
+	*pbm = *dst
+}
+
+// Rotate90CW rotates the image 90 degrees clockwise.
+func (pbm *PBM) Rotate90CW() { pbm.reorient(rotate90CW) }
+
+// Rotate90CCW rotates the image 90 degrees counter-clockwise.
+func (pbm *PBM) Rotate90CCW() { pbm.reorient(rotate90CCW) }
+
+// Rotate180 rotates the image by 180 degrees.
+func (pbm *PBM) Rotate180() { pbm.reorient(rotate180) }
+
+// Transpose mirrors the image along its main diagonal, swapping rows and columns.
+func (pbm *PBM) Transpose() { pbm.reorient(transpose) }
+
+// Transverse mirrors the image along its anti-diagonal.
+func (pbm *PBM) Transverse() { pbm.reorient(transverse) }
+
+// reorient rearranges the pixels of the image by the orientation.
+func (pgm *PGM) reorient(o orientation) {
+	w, h := pgm.width, pgm.height
+	if o.swapsAxes() {
+		w, h = h, w
+	}
+	dst := newPGM(w, h, pgm.magicNumber, pgm.max)
+	reorient(pgm.row, pgm.width, pgm.height, dst.row, 1, o)
+	*pgm = *dst
+}
+
+// Rotate90CCW rotates the image 90 degrees counter-clockwise.
+func (pgm *PGM) Rotate90CCW() { pgm.reorient(rotate90CCW) }
+
+// Rotate180 rotates the image by 180 degrees.
+func (pgm *PGM) Rotate180() { pgm.reorient(rotate180) }
+
+// Transpose mirrors the image along its main diagonal, swapping rows and columns.
+func (pgm *PGM) Transpose() { pgm.reorient(transpose) }
+
+// Transverse mirrors the image along its anti-diagonal.
+func (pgm *PGM) Transverse() { pgm.reorient(transverse) }
+
+// reorient rearranges the pixels of the image by the orientation.
+func (ppm *PPM) reorient(o orientation) {
+	w, h := ppm.width, ppm.height
+	if o.swapsAxes() {
+		w, h = h, w
+	}
+	dst := newPPM(w, h, ppm.magicNumber, ppm.max)
+	reorient(ppm.row, ppm.width, ppm.height, dst.row, 3, o)
+	*ppm = *dst
+}
+
+// Rotate90CCW rotates the image 90 degrees counter-clockwise.
+func (ppm *PPM) Rotate90CCW() { ppm.reorient(rotate90CCW) }
+
+// Rotate180 rotates the image by 180 degrees.
+func (ppm *PPM) Rotate180() { ppm.reorient(rotate180) }
+
+// Transpose mirrors the image along its main diagonal, swapping rows and columns.
+func (ppm *PPM) Transpose() { ppm.reorient(transpose) }
+
+// Transverse mirrors the image along its anti-diagonal.
+func (ppm *PPM) Transverse() { ppm.reorient(transverse) }
+
+// reorient rearranges the tuples of the image by the orientation.
+func (pam *PAM) reorient(o orientation) {
+	w, h := pam.width, pam.height
+	if o.swapsAxes() {
+		w, h = h, w
+	}
+	dst := newPAM(w, h, pam.depth, pam.max, pam.tupleType)
+	reorient(pam.row, pam.width, pam.height, dst.row, pam.depth, o)
+	*pam = *dst
+}
+
+// Rotate90CW rotates the image 90 degrees clockwise.
+func (pam *PAM) Rotate90CW() { pam.reorient(rotate90CW) }
+
+// Rotate90CCW rotates the image 90 degrees counter-clockwise.
+func (pam *PAM) Rotate90CCW() { pam.reorient(rotate90CCW) }
+
+// Rotate180 rotates the image by 180 degrees.
+func (pam *PAM) Rotate180() { pam.reorient(rotate180) }
+
+// Transpose mirrors the image along its main diagonal, swapping rows and columns.
+func (pam *PAM) Transpose() { pam.reorient(transpose) }
+
+// Transverse mirrors the image along its anti-diagonal.
+func (pam *PAM) Transverse() { pam.reorient(transverse) }
+
+// RotateOptions controls Rotate. A nil *RotateOptions uses the zero value:
+// nearest-neighbor sampling, a constant edge filled with zero samples and an
+// output the size of the source image.
+type RotateOptions struct {
+	// Filter interpolates between source pixels. Every filter but
+	// NearestNeighbor rotates PBM images as gray levels and thresholds the
+	// result at half.
+	Filter Filter
+	// Edge selects what is read outside the source image.
+	Edge EdgeMode
+	// Background is the color read outside the image with EdgeConstant. Nil
+	// means zero samples: white for PBM images, black for PGM and PPM images,
+	// and a zero tuple, transparent if the tuple type has alpha, for PAM images.
+	Background color.Color
+	// Expand grows the canvas to hold the whole rotated image. Otherwise the
+	// image keeps its size and the corners are cut off.
+	Expand bool
+}
+
+// warpOptions returns the options shared with Affine and Perspective.
+func (o *RotateOptions) warpOptions() *WarpOptions {
+	if o == nil {
+		return &WarpOptions{}
+	}
+	return &WarpOptions{Filter: o.Filter, Edge: o.Edge, Background: o.Background}
+}
+
+// rotation checks the source and options of a rotation of a w x h image by
+// degrees clockwise, and returns the size of the result and the mapping from
+// destination to source positions. samples is the number of samples per pixel.
+func (o *RotateOptions) rotation(w, h, samples int, degrees float64) (dw, dh int, inverse func(x, y float64) (float64, float64), err error) {
+	if err := checkSource(w, h); err != nil {
+		return 0, 0, nil, err
+	}
+	if err := o.warpOptions().check(samples); err != nil {
+		return 0, 0, nil, err
+	}
+	dw, dh, inverse = rotation(w, h, degrees, o != nil && o.Expand)
+	if err := checkDimensions(dw, dh, samples); err != nil {
+		return 0, 0, nil, err
+	}
+	return dw, dh, inverse, nil
+}
+
+// rotation returns the size of an image of size (w, h) rotated clockwise by
+// degrees, and the mapping from destination to source positions. Unless
+// expand is true, the size does not change and the corners are cut off.
+func rotation(w, h int, degrees float64, expand bool) (dw, dh int, inverse func(x, y float64) (float64, float64)) {
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	dw, dh = w, h
+	if expand {
+		// Round off floating-point noise so that quarter turns keep exact sizes
+		dw = int(math.Ceil(math.Abs(float64(w)*cos) + math.Abs(float64(h)*sin) - 1e-9))
+		dh = int(math.Ceil(math.Abs(float64(w)*sin) + math.Abs(float64(h)*cos) - 1e-9))
+	}
+
+	// Rotate around the centers of both images. With y pointing down, the
+	// forward rotation (x cos - y sin, x sin + y cos) turns clockwise.
+	scx, scy := float64(w)/2, float64(h)/2
+	dcx, dcy := float64(dw)/2, float64(dh)/2
+	return dw, dh, func(x, y float64) (float64, float64) {
+		x, y = x-dcx, y-dcy
+		return x*cos + y*sin + scx, -x*sin + y*cos + scy
+	}
+}
+
+// Rotate rotates the image clockwise by degrees, as configured by opts.
+// It returns an error if the image is empty or the options are invalid.
+func (pbm *PBM) Rotate(degrees float64, opts *RotateOptions) error {
+	dw, dh, inverse, err := opts.rotation(pbm.width, pbm.height, 1, degrees)
+	if err != nil {
+		return err
+	}
+
+	o := opts.warpOptions()
+	bg := 0.0
+	if o.Background != nil && bitmapPalette.Index(o.Background) == 1 {
+		bg = 1
+	}
+	s := &sampler[uint8]{row: pbm.row, width: pbm.width, height: pbm.height, n: 1, filter: o.Filter, edge: o.Edge, background: []float64{bg}}
+	dst := newPBM(dw, dh, pbm.magicNumber)
+	warp(s, dst.row, dw, dh, 1, inverse)
+	*pbm = *dst
+	return nil
+}
+
+// Rotate rotates the image clockwise by degrees, as configured by opts.
+// It returns an error if the image is empty or the options are invalid.
+func (pgm *PGM) Rotate(degrees float64, opts *RotateOptions) error {
+	dw, dh, inverse, err := opts.rotation(pgm.width, pgm.height, 1, degrees)
+	if err != nil {
+		return err
+	}
+
+	s := opts.warpOptions().sampler(pgm.row, pgm.width, pgm.height, 1, pgm.max)
+	dst := newPGM(dw, dh, pgm.magicNumber, pgm.max)
+	warp(s, dst.row, dw, dh, pgm.max, inverse)
+	*pgm = *dst
+	return nil
+}
+
+// Rotate rotates the image clockwise by degrees, as configured by opts.
+// It returns an error if the image is empty or the options are invalid.
+func (ppm *PPM) Rotate(degrees float64, opts *RotateOptions) error {
+	dw, dh, inverse, err := opts.rotation(ppm.width, ppm.height, 3, degrees)
+	if err != nil {
+		return err
+	}
+
+	s := opts.warpOptions().sampler(ppm.row, ppm.width, ppm.height, 3, ppm.max)
+	dst := newPPM(dw, dh, ppm.magicNumber, ppm.max)
+	warp(s, dst.row, dw, dh, ppm.max, inverse)
+	*ppm = *dst
+	return nil
+}
+
+// background returns the tuple matching c, with the color samples first and
+// the alpha sample, if any, last. Other samples are 0.
+func (pam *PAM) background(c color.Color) []float64 {
+	bg := make([]float64, pam.depth)
+	if c == nil {
+		return bg
+	}
+	scale := func(v uint32) float64 {
+		return float64(scaleSample(uint16(v), 0xffff, pam.max))
+	}
+
+	// Images with alpha store unpremultiplied colors
+	r, g, b, _ := c.RGBA()
+	if pam.HasAlpha() {
+		n := color.NRGBA64Model.Convert(c).(color.NRGBA64)
+		r, g, b = uint32(n.R), uint32(n.G), uint32(n.B)
+		bg[pam.depth-1] = scale(uint32(n.A))
+	}
+	if pam.colorChannels() == 3 {
+		bg[0], bg[1], bg[2] = scale(r), scale(g), scale(b)
+	} else {
+		bg[0] = scale(uint32(luma16(r, g, b)))
+	}
+	return bg
+}
+
+// Rotate rotates the image clockwise by degrees, as configured by opts.
+// It returns an error if the image is empty or the options are invalid.
+func (pam *PAM) Rotate(degrees float64, opts *RotateOptions) error {
+	dw, dh, inverse, err := opts.rotation(pam.width, pam.height, pam.depth, degrees)
+	if err != nil {
+		return err
+	}
+
+	o := opts.warpOptions()
+	s := &sampler[uint16]{row: pam.row, width: pam.width, height: pam.height, n: pam.depth, filter: o.Filter, edge: o.Edge, background: pam.background(o.Background)}
+	dst := newPAM(dw, dh, pam.depth, pam.max, pam.tupleType)
+	warp(s, dst.row, dw, dh, pam.max, inverse)
+	*pam = *dst
+	return nil
+}
@@ -0,0 +1,198 @@
+package Netpbm
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+func TestReorient(t *testing.T) {
+	// 1 2 3
+	// 4 5 6
+	tests := []struct {
+		name          string
+		apply         func(*PGM)
+		width, height int
+		want          []uint16
+	}{
+		{"Rotate90CW", (*PGM).Rotate90CW, 2, 3, []uint16{4, 1, 5, 2, 6, 3}},
+		{"Rotate90CCW", (*PGM).Rotate90CCW, 2, 3, []uint16{3, 6, 2, 5, 1, 4}},
+		{"Rotate180", (*PGM).Rotate180, 3, 2, []uint16{6, 5, 4, 3, 2, 1}},
+		{"Transpose", (*PGM).Transpose, 2, 3, []uint16{1, 4, 2, 5, 3, 6}},
+		{"Transverse", (*PGM).Transverse, 2, 3, []uint16{6, 3, 5, 2, 4, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgm, _ := NewPGM(3, 2, "P2", 255)
+			copy(pgm.Pix(), []uint16{1, 2, 3, 4, 5, 6})
+			tt.apply(pgm)
+			if w, h := pgm.Size(); w != tt.width || h != tt.height {
+				t.Fatalf("size = %dx%d, want %dx%d", w, h, tt.width, tt.height)
+			}
+			if !slices.Equal(pgm.Pix(), tt.want) {
+				t.Errorf("pixels = %v, want %v", pgm.Pix(), tt.want)
+			}
+
+			// The other types follow the same map
+			ppm := patternPPM(t, 3, 2, 255)
+			pam := ppm.ToPAM()
+			want := ppm.Clone()
+			switch tt.name {
+			case "Rotate90CW":
+				ppm.Rotate90CW()
+				pam.Rotate90CW()
+			case "Rotate90CCW":
+				ppm.Rotate90CCW()
+				pam.Rotate90CCW()
+			case "Rotate180":
+				ppm.Rotate180()
+				pam.Rotate180()
+			case "Transpose":
+				ppm.Transpose()
+				pam.Transpose()
+			case "Transverse":
+				ppm.Transverse()
+				pam.Transverse()
+			}
+			for i, v := range tt.want {
+				x, y := i%tt.width, i/tt.width
+				sx, sy := int(v-1)%3, int(v-1)/3
+				if got := ppm.PixelAt(x, y); got != want.PixelAt(sx, sy) {
+					t.Errorf("PPM pixel (%d, %d) = %v, want %v", x, y, got, want.PixelAt(sx, sy))
+				}
+				if got := pam.At(x, y); !slices.Equal(got, want.ToPAM().At(sx, sy)) {
+					t.Errorf("PAM tuple (%d, %d) = %v, want %v", x, y, got, want.ToPAM().At(sx, sy))
+				}
+			}
+		})
+	}
+}
+
+func TestRotateQuarterTurn(t *testing.T) {
+	opts := &RotateOptions{Expand: true}
+
+	pgm := patternPGM(t, 5, 3, 255)
+	want := pgm.Clone()
+	want.Rotate90CW()
+	if err := pgm.Rotate(90, opts); err != nil {
+		t.Fatalf("PGM.Rotate: %v", err)
+	}
+	if !pgm.Equal(want) {
+		t.Errorf("PGM.Rotate(90) = %v, want %v", pgm.Pix(), want.Pix())
+	}
+
+	ppm := patternPPM(t, 5, 3, 255)
+	wantPPM := ppm.Clone()
+	wantPPM.Rotate90CW()
+	if err := ppm.Rotate(90, opts); err != nil {
+		t.Fatalf("PPM.Rotate: %v", err)
+	}
+	if !ppm.Equal(wantPPM) {
+		t.Error("PPM.Rotate(90) differs from Rotate90CW")
+	}
+
+	pbm := patternPGM(t, 5, 3, 255).ToPBM()
+	wantPBM := pbm.Clone()
+	wantPBM.Rotate90CW()
+	if err := pbm.Rotate(90, opts); err != nil {
+		t.Fatalf("PBM.Rotate: %v", err)
+	}
+	if !pbm.Equal(wantPBM) {
+		t.Error("PBM.Rotate(90) differs from Rotate90CW")
+	}
+
+	pam := patternPPM(t, 5, 3, 255).ToPAM()
+	wantPAM := pam.Clone()
+	wantPAM.Rotate90CW()
+	if err := pam.Rotate(90, opts); err != nil {
+		t.Fatalf("PAM.Rotate: %v", err)
+	}
+	if !pam.Equal(wantPAM) {
+		t.Error("PAM.Rotate(90) differs from Rotate90CW")
+	}
+
+	// A full turn keeps the image, with or without expanding
+	for _, o := range []*RotateOptions{nil, opts} {
+		pgm := patternPGM(t, 5, 3, 255)
+		if err := pgm.Rotate(360, o); err != nil {
+			t.Fatal(err)
+		}
+		if want := patternPGM(t, 5, 3, 255); !pgm.Equal(want) {
+			t.Errorf("Rotate(360, %+v) = %v, want %v", o, pgm.Pix(), want.Pix())
+		}
+	}
+}
+
+func TestRotateBackground(t *testing.T) {
+	// Corners cut by a 45 degree turn show the background
+	pgm, _ := NewPGM(9, 9, "P2", 1000, 500)
+	if err := pgm.Rotate(45, &RotateOptions{Background: color.White}); err != nil {
+		t.Fatal(err)
+	}
+	if got := pgm.GrayAt(0, 0); got != 1000 {
+		t.Errorf("PGM corner = %d, want 1000", got)
+	}
+	if got := pgm.GrayAt(4, 4); got != 500 {
+		t.Errorf("PGM center = %d, want 500", got)
+	}
+
+	ppm, _ := NewPPM(9, 9, "P3", 255)
+	if err := ppm.Rotate(45, &RotateOptions{Background: color.RGBA{255, 0, 0, 255}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := ppm.PixelAt(8, 0); got != (Pixel{255, 0, 0}) {
+		t.Errorf("PPM corner = %v, want red", got)
+	}
+
+	pbm, _ := NewPBM(9, 9, "P1")
+	if err := pbm.Rotate(45, &RotateOptions{Background: color.Black}); err != nil {
+		t.Fatal(err)
+	}
+	if !pbm.BitAt(0, 8) || pbm.BitAt(4, 4) {
+		t.Errorf("PBM corner %v and center %v, want black and white", pbm.BitAt(0, 8), pbm.BitAt(4, 4))
+	}
+
+	pam := pgm.ToPAM()
+	alpha, _ := NewPGM(9, 9, "P2", 1000, 1000)
+	if err := pam.AddAlpha(alpha); err != nil {
+		t.Fatal(err)
+	}
+	if err := pam.Rotate(45, &RotateOptions{Expand: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := pam.At(0, 0); !slices.Equal(got, []uint16{0, 0}) {
+		t.Errorf("PAM corner = %v, want transparent", got)
+	}
+}
+
+func TestRotateErrors(t *testing.T) {
+	pgm := patternPGM(t, 4, 4, 255)
+	if err := pgm.SubImage(image.Rect(2, 0, 2, 4)).Rotate(30, nil); err == nil {
+		t.Error("PGM.Rotate of an empty image succeeded")
+	}
+	if err := pgm.SubImage(image.Rectangle{}).Rotate(30, &RotateOptions{Edge: EdgeWrap}); err == nil {
+		t.Error("PGM.Rotate of an empty image with EdgeWrap succeeded")
+	}
+	if err := patternPPM(t, 4, 4, 255).SubImage(image.Rectangle{}).Rotate(30, nil); err == nil {
+		t.Error("PPM.Rotate of an empty image succeeded")
+	}
+	pbm, _ := NewPBM(4, 4, "P1")
+	if err := pbm.SubImage(image.Rectangle{}).Rotate(30, nil); err == nil {
+		t.Error("PBM.Rotate of an empty image succeeded")
+	}
+	if err := pgm.ToPAM().SubImage(image.Rectangle{}).Rotate(30, nil); err == nil {
+		t.Error("PAM.Rotate of an empty image succeeded")
+	}
+
+	before := pgm.Clone()
+	if err := pgm.Rotate(30, &RotateOptions{Filter: Lanczos + 1}); err == nil {
+		t.Error("Rotate with an unknown filter succeeded")
+	}
+	if err := pgm.Rotate(30, &RotateOptions{Edge: EdgeWrap + 1}); err == nil {
+		t.Error("Rotate with an unknown edge mode succeeded")
+	}
+	if !pgm.Equal(before) {
+		t.Error("failed Rotate changed the image")
+	}
+}
@@ -0,0 +1,305 @@
+package Netpbm
+
+import (
+	"fmt"
+	"math"
+)
+
+// ThresholdMethod selects how Binarize chooses the gray level below which pixels become black.
+type ThresholdMethod int
+
+const (
+	// ThresholdOtsu picks the global level that best separates the histogram
+	// into two classes, by Otsu's method.
+	ThresholdOtsu ThresholdMethod = iota
+	// ThresholdManual uses the global level Level times the maximum value.
+	ThresholdManual
+	// ThresholdPercentile picks the global level so that a fraction Level of
+	// the pixels, the darkest ones, become black.
+	ThresholdPercentile
+	// ThresholdMean compares each pixel with the mean of the Window x Window
+	// pixels around it, minus Offset times the maximum value.
+	ThresholdMean
+	// ThresholdGaussian is ThresholdMean with a Gaussian-weighted mean.
+	ThresholdGaussian
+	// ThresholdNiblack uses mean + K*deviation over the window, with K -0.2 by default.
+	ThresholdNiblack
+	// ThresholdSauvola uses mean * (1 + K*(deviation/R - 1)) over the window,
+	// R being half the maximum value and K 0.2 by default. It copes well with
+	// stains and uneven lighting on text.
+	ThresholdSauvola
+)
+
+// ThresholdOptions controls Binarize. A nil *ThresholdOptions uses Otsu's method.
+type ThresholdOptions struct {
+	// Method is the thresholding algorithm.
+	Method ThresholdMethod
+	// Level is the threshold, from 0 to 1, for ThresholdManual and ThresholdPercentile.
+	Level float64
+	// Window is the odd size in pixels of the neighborhood used by the local
+	// methods. Zero means 15.
+	Window int
+	// Offset is subtracted from the local mean by ThresholdMean and
+	// ThresholdGaussian, as a fraction of the maximum value.
+	Offset float64
+	// K weighs the deviation for ThresholdNiblack and ThresholdSauvola.
+	// Zero means the default of the method.
+	K float64
+	// Gray selects how PPM.Binarize turns colors into gray levels before
+	// thresholding. Gray images ignore it.
+	Gray GrayOptions
+}
+
+// withDefaults returns a copy of the options with defaults filled in, or an error if they are invalid.
+func (o *ThresholdOptions) withDefaults() (ThresholdOptions, error) {
+	var opts ThresholdOptions
+	if o != nil {
+		opts = *o
+	}
+	if opts.Window == 0 {
+		opts.Window = 15
+	}
+	if opts.K == 0 {
+		switch opts.Method {
+		case ThresholdNiblack:
+			opts.K = -0.2
+		case ThresholdSauvola:
+			opts.K = 0.2
+		}
+	}
+
+	if opts.Method < ThresholdOtsu || opts.Method > ThresholdSauvola {
+		return opts, fmt.Errorf("netpbm: unknown threshold method %d", opts.Method)
+	}
+	if opts.Window < 1 || opts.Window%2 == 0 {
+		return opts, fmt.Errorf("netpbm: threshold window %d is not a positive odd number", opts.Window)
+	}
+	if opts.Level < 0 || opts.Level > 1 {
+		return opts, fmt.Errorf("netpbm: threshold level %v is outside 0 to 1", opts.Level)
+	}
+	return opts, nil
+}
+
+// histogram returns the number of pixels of each gray level, from 0 to the maximum value.
+func (pgm *PGM) histogram() []int {
+	hist := make([]int, int(pgm.max)+1)
+	for y := 0; y < pgm.height; y++ {
+		for _, v := range pgm.row(y) {
+			hist[v]++
+		}
+	}
+	return hist
+}
+
+// otsuLevel returns the gray level that maximizes the variance between the
+// pixels at or below it and those above it.
+func otsuLevel(hist []int) int {
+	var total, sum float64
+	for v, n := range hist {
+		total += float64(n)
+		sum += float64(v) * float64(n)
+	}
+
+	var best float64
+	level := 0
+	var count, partial float64
+	for v, n := range hist {
+		count += float64(n)
+		partial += float64(v) * float64(n)
+		if count == 0 || count == total {
+			continue
+		}
+		mean0, mean1 := partial/count, (sum-partial)/(total-count)
+		if between := count * (total - count) * (mean0 - mean1) * (mean0 - mean1); between > best {
+			best, level = between, v
+		}
+	}
+	return level
+}
+
+// percentileLevel returns the lowest gray level at or below which at least a fraction p of the pixels lie.
+// For p = 0 it returns -1, so that no pixel is at or below it.
+func percentileLevel(hist []int, p float64) int {
+	var total int
+	for _, n := range hist {
+		total += n
+	}
+	want := int(math.Ceil(p * float64(total)))
+	if want == 0 {
+		return -1
+	}
+	count := 0
+	for v, n := range hist {
+		count += n
+		if count >= want {
+			return v
+		}
+	}
+	return len(hist) - 1
+}
+
+// globalThreshold makes the pixels at or below level black.
+func (pgm *PGM) globalThreshold(level float64) *PBM {
+	pbm := newPBM(pgm.width, pgm.height, "P1")
+	for y := 0; y < pgm.height; y++ {
+		row := pbm.row(y)
+		for x, v := range pgm.row(y) {
+			if float64(v) <= level {
+				row[x] = 1
+			}
+		}
+	}
+	return pbm
+}
+
+// localMeans calls f for every row y with the mean and standard deviation of
+// the window x window neighborhood of each pixel of the row. Neighborhoods
+// are clipped to the image. Only one row of sums is kept, so memory does not
+// grow with the height of the image.
+func (pgm *PGM) localMeans(window int, f func(y int, mean, deviation []float64)) {
+	r := window / 2
+	colSum := make([]float64, pgm.width)
+	colSq := make([]float64, pgm.width)
+	mean := make([]float64, pgm.width)
+	deviation := make([]float64, pgm.width)
+
+	addRow := func(y int, sign float64) {
+		for x, v := range pgm.row(y) {
+			colSum[x] += sign * float64(v)
+			colSq[x] += sign * float64(v) * float64(v)
+		}
+	}
+	for y := 0; y < r && y < pgm.height; y++ {
+		addRow(y, 1)
+	}
+
+	for y := 0; y < pgm.height; y++ {
+		// Slide the window of rows down to y-r..y+r
+		if y+r < pgm.height {
+			addRow(y+r, 1)
+		}
+		if y-r-1 >= 0 {
+			addRow(y-r-1, -1)
+		}
+		rows := float64(min(y+r, pgm.height-1) - max(y-r, 0) + 1)
+
+		// Slide the window of columns along the row
+		var sum, sq float64
+		for x := 0; x < r && x < pgm.width; x++ {
+			sum += colSum[x]
+			sq += colSq[x]
+		}
+		for x := 0; x < pgm.width; x++ {
+			if x+r < pgm.width {
+				sum += colSum[x+r]
+				sq += colSq[x+r]
+			}
+			if x-r-1 >= 0 {
+				sum -= colSum[x-r-1]
+				sq -= colSq[x-r-1]
+			}
+			n := rows * float64(min(x+r, pgm.width-1)-max(x-r, 0)+1)
+			mean[x] = sum / n
+			deviation[x] = math.Sqrt(math.Max(sq/n-mean[x]*mean[x], 0))
+		}
+		f(y, mean, deviation)
+	}
+}
+
+// gaussianMeans calls f for every row y with the Gaussian-weighted mean of
+// the window x window neighborhood of each pixel of the row. Pixels past the
+// edges repeat the edge pixels.
+func (pgm *PGM) gaussianMeans(window int, f func(y int, mean []float64)) {
+	// Same sigma for a given window size as OpenCV
+	r := window / 2
+	sigma := 0.3*(float64(window-1)*0.5-1) + 0.8
+	weights := make([]float64, window)
+	var total float64
+	for i := range weights {
+		d := float64(i - r)
+		weights[i] = math.Exp(-d * d / (2 * sigma * sigma))
+		total += weights[i]
+	}
+	for i := range weights {
+		weights[i] /= total
+	}
+
+	cols := make([]float64, pgm.width)
+	mean := make([]float64, pgm.width)
+	for y := 0; y < pgm.height; y++ {
+		for x := range cols {
+			cols[x] = 0
+		}
+		for i, w := range weights {
+			for x, v := range pgm.row(min(max(y+i-r, 0), pgm.height-1)) {
+				cols[x] += w * float64(v)
+			}
+		}
+		for x := range mean {
+			mean[x] = 0
+			for i, w := range weights {
+				mean[x] += w * cols[min(max(x+i-r, 0), pgm.width-1)]
+			}
+		}
+		f(y, mean)
+	}
+}
+
+// Function that converts the PGM image to a PBM image with a threshold chosen by opts. Global methods make black
+// the pixels at or below the threshold. Local methods compute a threshold for every pixel, which copes with uneven
+// lighting, and make black the pixels below it, so that flat areas stay white.
+func (pgm *PGM) Binarize(opts *ThresholdOptions) (*PBM, error) {
+	o, err := opts.withDefaults()
+	if err != nil {
+		return nil, err
+	}
+	white := float64(pgm.max)
+
+	switch o.Method {
+	case ThresholdOtsu:
+		return pgm.globalThreshold(float64(otsuLevel(pgm.histogram()))), nil
+	case ThresholdManual:
+		return pgm.globalThreshold(o.Level * white), nil
+	case ThresholdPercentile:
+		return pgm.globalThreshold(float64(percentileLevel(pgm.histogram(), o.Level))), nil
+	}
+
+	pbm := newPBM(pgm.width, pgm.height, "P1")
+	mark := func(y int, level func(x int) float64) {
+		row := pbm.row(y)
+		for x, v := range pgm.row(y) {
+			if float64(v) < level(x) {
+				row[x] = 1
+			}
+		}
+	}
+	switch o.Method {
+	case ThresholdGaussian:
+		pgm.gaussianMeans(o.Window, func(y int, mean []float64) {
+			mark(y, func(x int) float64 { return mean[x] - o.Offset*white })
+		})
+	case ThresholdMean:
+		pgm.localMeans(o.Window, func(y int, mean, _ []float64) {
+			mark(y, func(x int) float64 { return mean[x] - o.Offset*white })
+		})
+	case ThresholdNiblack:
+		pgm.localMeans(o.Window, func(y int, mean, deviation []float64) {
+			mark(y, func(x int) float64 { return mean[x] + o.K*deviation[x] })
+		})
+	case ThresholdSauvola:
+		pgm.localMeans(o.Window, func(y int, mean, deviation []float64) {
+			mark(y, func(x int) float64 { return mean[x] * (1 + o.K*(deviation[x]/(white/2)-1)) })
+		})
+	}
+	return pbm, nil
+}
+
+// Binarize converts the PPM image to gray as ToPGM does with opts.Gray, then
+// to a PBM image as PGM.Binarize does.
+func (ppm *PPM) Binarize(opts *ThresholdOptions) (*PBM, error) {
+	var gray GrayOptions
+	if opts != nil {
+		gray = opts.Gray
+	}
+	return ppm.ToPGM(gray).Binarize(opts)
+}
@@ -0,0 +1,125 @@
+package Netpbm
+
+import (
+	"image/color"
+	"slices"
+	"testing"
+)
+
+func TestOtsuLevel(t *testing.T) {
+	// Two clusters, around 40 and around 200
+	hist := make([]int, 256)
+	for _, v := range []int{35, 38, 40, 42, 45} {
+		hist[v] = 100
+	}
+	for _, v := range []int{190, 195, 200, 205, 210} {
+		hist[v] = 60
+	}
+	level := otsuLevel(hist)
+	if level < 45 || level >= 190 {
+		t.Errorf("otsuLevel = %d, want between the clusters", level)
+	}
+
+	pgm, _ := NewPGM(4, 2, "P2", 255)
+	copy(pgm.Pix(), []uint16{40, 200, 42, 198, 38, 205, 40, 200})
+	pbm, err := pgm.Binarize(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint8{1, 0, 1, 0, 1, 0, 1, 0}; !slices.Equal(pbm.Pix(), want) {
+		t.Errorf("Binarize = %v, want %v", pbm.Pix(), want)
+	}
+}
+
+func TestBinarizeGlobal(t *testing.T) {
+	pgm, _ := NewPGM(5, 1, "P2", 100)
+	copy(pgm.Pix(), []uint16{0, 25, 50, 75, 100})
+	tests := []struct {
+		name string
+		opts ThresholdOptions
+		want []uint8
+	}{
+		{"manual half", ThresholdOptions{Method: ThresholdManual, Level: 0.5}, []uint8{1, 1, 1, 0, 0}},
+		{"manual 0", ThresholdOptions{Method: ThresholdManual}, []uint8{1, 0, 0, 0, 0}},
+		{"percentile 0", ThresholdOptions{Method: ThresholdPercentile}, []uint8{0, 0, 0, 0, 0}},
+		{"percentile 0.4", ThresholdOptions{Method: ThresholdPercentile, Level: 0.4}, []uint8{1, 1, 0, 0, 0}},
+		{"percentile 1", ThresholdOptions{Method: ThresholdPercentile, Level: 1}, []uint8{1, 1, 1, 1, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pbm, err := pgm.Binarize(&tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(pbm.Pix(), tt.want) {
+				t.Errorf("Binarize = %v, want %v", pbm.Pix(), tt.want)
+			}
+		})
+	}
+}
+
+func TestBinarizeLocal(t *testing.T) {
+	// Dark text on a background that brightens from left to right, which
+	// no global threshold can separate
+	pgm, _ := NewPGM(40, 9, "P2", 255)
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 40; x++ {
+			bg := 60 + 4*x
+			v := bg
+			if x%8 == 4 && y >= 2 && y <= 6 {
+				v = bg - 50
+			}
+			pgm.SetGray(x, y, uint16(v))
+		}
+	}
+	for _, m := range []ThresholdMethod{ThresholdMean, ThresholdGaussian, ThresholdNiblack, ThresholdSauvola} {
+		pbm, err := pgm.Binarize(&ThresholdOptions{Method: m, Window: 5, Offset: 0.05})
+		if err != nil {
+			t.Fatalf("method %d: %v", m, err)
+		}
+		for x := 4; x < 40; x += 8 {
+			if !pbm.BitAt(x, 4) {
+				t.Errorf("method %d: text pixel (%d, 4) is white", m, x)
+			}
+		}
+		if m == ThresholdMean || m == ThresholdGaussian {
+			if pbm.BitAt(0, 0) || pbm.BitAt(39, 8) {
+				t.Errorf("method %d: background is black", m)
+			}
+		}
+	}
+}
+
+func TestBinarizeErrors(t *testing.T) {
+	pgm, _ := NewPGM(4, 4, "P2", 255)
+	for _, opts := range []ThresholdOptions{
+		{Method: ThresholdSauvola + 1},
+		{Method: ThresholdMean, Window: 4},
+		{Method: ThresholdMean, Window: -3},
+		{Method: ThresholdManual, Level: 1.5},
+		{Method: ThresholdPercentile, Level: -0.1},
+	} {
+		if _, err := pgm.Binarize(&opts); err == nil {
+			t.Errorf("Binarize(%+v) succeeded", opts)
+		}
+	}
+}
+
+func TestBinarizeGray(t *testing.T) {
+	// Green is bright by luma but dark by the blue channel alone
+	ppm, _ := NewPPM(2, 1, "P3", 255)
+	ppm.Set(0, 0, color.RGBA{0, 255, 0, 255})
+	ppm.Set(1, 0, color.Black)
+	opts := &ThresholdOptions{Method: ThresholdManual, Level: 0.5, Gray: GrayOptions{Method: GrayRec709}}
+	pbm, err := ppm.Binarize(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pbm.BitAt(0, 0) {
+		t.Error("green is black with GrayRec709, want white")
+	}
+	opts.Gray.Method = GrayBlue
+	if pbm, _ = ppm.Binarize(opts); !pbm.BitAt(0, 0) {
+		t.Error("green is white with GrayBlue, want black")
+	}
+}
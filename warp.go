@@ -0,0 +1,369 @@
+package Netpbm
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+)
+
+// EdgeMode tells a warp what to read for positions outside the source image.
+type EdgeMode int
+
+const (
+	// EdgeConstant reads the background color outside the image.
+	EdgeConstant EdgeMode = iota
+	// EdgeClamp repeats the nearest edge pixel.
+	EdgeClamp
+	// EdgeWrap tiles the image, so that leaving one side enters the opposite one.
+	EdgeWrap
+)
+
+// WarpOptions controls Affine and Perspective. A nil *WarpOptions uses the
+// zero value: nearest-neighbor sampling, a black constant edge and an output
+// the size of the source image.
+type WarpOptions struct {
+	// Filter interpolates between source pixels.
+	Filter Filter
+	// Edge selects what is read outside the source image.
+	Edge EdgeMode
+	// Background is the color read outside the image with EdgeConstant.
+	// Nil means black.
+	Background color.Color
+	// Width and Height are the size of the output. Zero keeps the size of the source.
+	Width, Height int
+}
+
+// size returns the output size for a w x h source.
+func (o *WarpOptions) size(w, h int) (int, int) {
+	if o != nil && o.Width != 0 {
+		w = o.Width
+	}
+	if o != nil && o.Height != 0 {
+		h = o.Height
+	}
+	return w, h
+}
+
+// sampler returns a sampler over an image configured by the options.
+// n is 1 for gray images and 3 for RGB images.
+func (o *WarpOptions) sampler(row func(y int) []uint16, w, h, n int, max uint16) *sampler[uint16] {
+	var opts WarpOptions
+	if o != nil {
+		opts = *o
+	}
+	bg := make([]float64, n)
+	if opts.Background != nil {
+		r, g, b, _ := opts.Background.RGBA()
+		if n == 1 {
+			bg[0] = float64(scaleSample(luma16(r, g, b), 0xffff, max))
+		} else {
+			bg[0] = float64(scaleSample(uint16(r), 0xffff, max))
+			bg[1] = float64(scaleSample(uint16(g), 0xffff, max))
+			bg[2] = float64(scaleSample(uint16(b), 0xffff, max))
+		}
+	}
+	return &sampler[uint16]{row: row, width: w, height: h, n: n, filter: opts.Filter, edge: opts.Edge, background: bg}
+}
+
+// check returns an error if the options are invalid.
+func (o *WarpOptions) check(samples int) error {
+	if o == nil {
+		return nil
+	}
+	if w, h := o.size(1, 1); w != 1 || h != 1 {
+		if err := checkDimensions(w, h, samples); err != nil {
+			return err
+		}
+	}
+	if o.Edge < EdgeConstant || o.Edge > EdgeWrap {
+		return fmt.Errorf("netpbm: unknown edge mode %d", o.Edge)
+	}
+	return o.Filter.check()
+}
+
+// sampler reads an image at fractional positions, interpolating with a filter.
+type sampler[T uint8 | uint16] struct {
+	row           func(y int) []T
+	width, height int
+	// n is the number of samples per pixel.
+	n      int
+	filter Filter
+	edge   EdgeMode
+	// background holds the n samples read outside the image with EdgeConstant.
+	background []float64
+}
+
+// axisTaps returns the source pixels weighing on position p along an axis,
+// where pixel i covers p in [i, i+1).
+func (s *sampler[T]) axisTaps(p float64, taps []tap) []tap {
+	if s.filter == NearestNeighbor {
+		return append(taps, tap{int(math.Floor(p)), 1})
+	}
+	u := p - 0.5
+	r := s.filter.support()
+	for j := int(math.Floor(u-r)) + 1; j <= int(math.Floor(u+r)); j++ {
+		if w := s.filter.kernel(u - float64(j)); w != 0 {
+			taps = append(taps, tap{j, w})
+		}
+	}
+	return taps
+}
+
+// edgeIndex maps index i along an axis of size n to a pixel inside the image
+// according to the edge mode. It returns -1 for the background.
+func (s *sampler[T]) edgeIndex(i, n int) int {
+	if i >= 0 && i < n {
+		return i
+	}
+	switch s.edge {
+	case EdgeClamp:
+		return min(max(i, 0), n-1)
+	case EdgeWrap:
+		return (i%n + n) % n
+	}
+	return -1
+}
+
+// sample writes to out the n samples of the image at (x, y), in pixel
+// coordinates where the pixel (i, j) covers [i, i+1) x [j, j+1).
+// Positions that are not finite, or too far away to index, read as outside.
+func (s *sampler[T]) sample(x, y float64, out []float64) {
+	if !(math.Abs(x) < 1<<30 && math.Abs(y) < 1<<30) {
+		copy(out, s.background)
+		return
+	}
+
+	var xBuf, yBuf [8]tap
+	xTaps, yTaps := s.axisTaps(x, xBuf[:0]), s.axisTaps(y, yBuf[:0])
+
+	for c := range out {
+		out[c] = 0
+	}
+	var sum float64
+	for _, ty := range yTaps {
+		var row []T
+		if j := s.edgeIndex(ty.index, s.height); j >= 0 {
+			row = s.row(j)
+		}
+		for _, tx := range xTaps {
+			w := ty.weight * tx.weight
+			sum += w
+			i := s.edgeIndex(tx.index, s.width)
+			if row == nil || i < 0 {
+				for c := range out {
+					out[c] += w * s.background[c]
+				}
+				continue
+			}
+			for c := range out {
+				out[c] += w * float64(row[i*s.n+c])
+			}
+		}
+	}
+	for c := range out {
+		out[c] /= sum
+	}
+}
+
+// warp fills dst, of size (dw, dh), by reading s at the source position that
+// inverse returns for the center of each destination pixel.
+// Results are rounded and clamped to 0..max.
+func warp[T uint8 | uint16](s *sampler[T], dst func(y int) []T, dw, dh int, max T, inverse func(x, y float64) (float64, float64)) {
+	v := make([]float64, s.n)
+	for y := 0; y < dh; y++ {
+		out := dst(y)
+		for x := 0; x < dw; x++ {
+			sx, sy := inverse(float64(x)+0.5, float64(y)+0.5)
+			s.sample(sx, sy, v)
+			for c, f := range v {
+				out[x*s.n+c] = T(math.Min(math.Max(f+0.5, 0), float64(max)))
+			}
+		}
+	}
+}
+
+// invertAffine returns the inverse of the affine transformation m.
+func invertAffine(m [2][3]float64) ([2][3]float64, error) {
+	det := m[0][0]*m[1][1] - m[0][1]*m[1][0]
+	if det == 0 || math.IsNaN(det) || math.IsInf(det, 0) {
+		return m, ErrSingularMatrix
+	}
+	a, b := m[1][1]/det, -m[0][1]/det
+	d, e := -m[1][0]/det, m[0][0]/det
+	return [2][3]float64{
+		{a, b, -a*m[0][2] - b*m[1][2]},
+		{d, e, -d*m[0][2] - e*m[1][2]},
+	}, nil
+}
+
+// invertHomography returns the inverse of the homography h times its
+// determinant, and the determinant.
+func invertHomography(h [3][3]float64) ([3][3]float64, float64, error) {
+	// The adjugate is the inverse times the determinant
+	var adj [3][3]float64
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			r0, r1 := (j+1)%3, (j+2)%3
+			c0, c1 := (i+1)%3, (i+2)%3
+			adj[i][j] = h[r0][c0]*h[r1][c1] - h[r0][c1]*h[r1][c0]
+		}
+	}
+	det := h[0][0]*adj[0][0] + h[0][1]*adj[1][0] + h[0][2]*adj[2][0]
+	if det == 0 || math.IsNaN(det) || math.IsInf(det, 0) {
+		return h, det, ErrSingularMatrix
+	}
+	return adj, det, nil
+}
+
+// centered converts a mapping between pixel-center coordinates, where the
+// center of the pixel at column x and row y is at (x, y), into a mapping
+// between the pixel-area coordinates used by samplers.
+func centered(f func(x, y float64) (float64, float64)) func(x, y float64) (float64, float64) {
+	return func(x, y float64) (float64, float64) {
+		sx, sy := f(x-0.5, y-0.5)
+		return sx + 0.5, sy + 0.5
+	}
+}
+
+// affineInverse returns the mapping from destination to source positions of the affine transformation m.
+func affineInverse(m [2][3]float64) (func(x, y float64) (float64, float64), error) {
+	inv, err := invertAffine(m)
+	if err != nil {
+		return nil, err
+	}
+	return centered(func(x, y float64) (float64, float64) {
+		return inv[0][0]*x + inv[0][1]*y + inv[0][2], inv[1][0]*x + inv[1][1]*y + inv[1][2]
+	}), nil
+}
+
+// perspectiveInverse returns the mapping from destination to source positions
+// of the homography h, for a source image of size (sw, sh). Positions whose
+// source lies on the horizon, or beyond it as seen from the center of the
+// source image, come out as NaN.
+func perspectiveInverse(h [3][3]float64, sw, sh int) (func(x, y float64) (float64, float64), error) {
+	inv, det, err := invertHomography(h)
+	if err != nil {
+		return nil, err
+	}
+	// The adjugate maps a destination point back to the source point (x, y)
+	// scaled by det/W, where W is the last coordinate of h × (x, y, 1). Points
+	// on the same side of the horizon as the center have W of the same sign.
+	cx, cy := float64(sw-1)/2, float64(sh-1)/2
+	sign := 1.0
+	if (det < 0) != (h[2][0]*cx+h[2][1]*cy+h[2][2] < 0) {
+		sign = -1
+	}
+	return centered(func(x, y float64) (float64, float64) {
+		w := sign * (inv[2][0]*x + inv[2][1]*y + inv[2][2])
+		if w <= 0 {
+			return math.NaN(), math.NaN()
+		}
+		return sign * (inv[0][0]*x + inv[0][1]*y + inv[0][2]) / w, sign * (inv[1][0]*x + inv[1][1]*y + inv[1][2]) / w
+	}), nil
+}
+
+// Affine applies the affine transformation m to the image. m maps a source
+// position (x, y) to the destination position
+//
+//	(m[0][0]*x + m[0][1]*y + m[0][2], m[1][0]*x + m[1][1]*y + m[1][2])
+//
+// where the center of the pixel at column x and row y is at (x, y). Each
+// output pixel is read from the source through the inverse of m, so the
+// result has no holes. It returns ErrSingularMatrix if m cannot be inverted.
+func (pgm *PGM) Affine(m [2][3]float64, opts *WarpOptions) error {
+	if err := opts.check(1); err != nil {
+		return err
+	}
+	inverse, err := affineInverse(m)
+	if err != nil {
+		return err
+	}
+	return pgm.warp(inverse, opts)
+}
+
+// Perspective applies the homography h to the image. h maps a source
+// position (x, y) to the destination position (X/W, Y/W), where
+//
+//	(X, Y, W) = h × (x, y, 1)
+//
+// and the center of the pixel at column x and row y is at (x, y). Each output
+// pixel is read from the source through the inverse of h; pixels mapped
+// beyond the horizon are filled with the background. It returns
+// ErrSingularMatrix if h cannot be inverted.
+func (pgm *PGM) Perspective(h [3][3]float64, opts *WarpOptions) error {
+	if err := opts.check(1); err != nil {
+		return err
+	}
+	inverse, err := perspectiveInverse(h, pgm.width, pgm.height)
+	if err != nil {
+		return err
+	}
+	return pgm.warp(inverse, opts)
+}
+
+// warp replaces the image by the warped one. It returns an error if the
+// image is empty, since there is nothing to sample from.
+func (pgm *PGM) warp(inverse func(x, y float64) (float64, float64), opts *WarpOptions) error {
+	if err := checkSource(pgm.width, pgm.height); err != nil {
+		return err
+	}
+	dw, dh := opts.size(pgm.width, pgm.height)
+	s := opts.sampler(pgm.row, pgm.width, pgm.height, 1, pgm.max)
+	dst := newPGM(dw, dh, pgm.magicNumber, pgm.max)
+	warp(s, dst.row, dw, dh, pgm.max, inverse)
+	*pgm = *dst
+	return nil
+}
+
+// Affine applies the affine transformation m to the image. m maps a source
+// position (x, y) to the destination position
+//
+//	(m[0][0]*x + m[0][1]*y + m[0][2], m[1][0]*x + m[1][1]*y + m[1][2])
+//
+// where the center of the pixel at column x and row y is at (x, y). Each
+// output pixel is read from the source through the inverse of m, so the
+// result has no holes. It returns ErrSingularMatrix if m cannot be inverted.
+func (ppm *PPM) Affine(m [2][3]float64, opts *WarpOptions) error {
+	if err := opts.check(3); err != nil {
+		return err
+	}
+	inverse, err := affineInverse(m)
+	if err != nil {
+		return err
+	}
+	return ppm.warp(inverse, opts)
+}
+
+// Perspective applies the homography h to the image. h maps a source
+// position (x, y) to the destination position (X/W, Y/W), where
+//
+//	(X, Y, W) = h × (x, y, 1)
+//
+// and the center of the pixel at column x and row y is at (x, y). Each output
+// pixel is read from the source through the inverse of h; pixels mapped
+// beyond the horizon are filled with the background. It returns
+// ErrSingularMatrix if h cannot be inverted.
+func (ppm *PPM) Perspective(h [3][3]float64, opts *WarpOptions) error {
+	if err := opts.check(3); err != nil {
+		return err
+	}
+	inverse, err := perspectiveInverse(h, ppm.width, ppm.height)
+	if err != nil {
+		return err
+	}
+	return ppm.warp(inverse, opts)
+}
+
+// warp replaces the image by the warped one. It returns an error if the
+// image is empty, since there is nothing to sample from.
+func (ppm *PPM) warp(inverse func(x, y float64) (float64, float64), opts *WarpOptions) error {
+	if err := checkSource(ppm.width, ppm.height); err != nil {
+		return err
+	}
+	dw, dh := opts.size(ppm.width, ppm.height)
+	s := opts.sampler(ppm.row, ppm.width, ppm.height, 3, ppm.max)
+	dst := newPPM(dw, dh, ppm.magicNumber, ppm.max)
+	warp(s, dst.row, dw, dh, ppm.max, inverse)
+	*ppm = *dst
+	return nil
+}
@@ -0,0 +1,166 @@
+package Netpbm
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+var (
+	identityAffine      = [2][3]float64{{1, 0, 0}, {0, 1, 0}}
+	identityPerspective = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+)
+
+func TestWarpIdentity(t *testing.T) {
+	for _, f := range filters {
+		t.Run(f.name, func(t *testing.T) {
+			opts := &WarpOptions{Filter: f.filter}
+
+			pgm := patternPGM(t, 7, 5, 1000)
+			got := pgm.Clone()
+			if err := got.Affine(identityAffine, opts); err != nil {
+				t.Fatalf("PGM.Affine: %v", err)
+			}
+			if !got.Equal(pgm) {
+				t.Errorf("PGM.Affine(identity) = %v, want %v", got.Pix(), pgm.Pix())
+			}
+			got = pgm.Clone()
+			if err := got.Perspective(identityPerspective, opts); err != nil {
+				t.Fatalf("PGM.Perspective: %v", err)
+			}
+			if !got.Equal(pgm) {
+				t.Errorf("PGM.Perspective(identity) = %v, want %v", got.Pix(), pgm.Pix())
+			}
+
+			ppm := patternPPM(t, 7, 5, 255)
+			gotPPM := ppm.Clone()
+			if err := gotPPM.Affine(identityAffine, opts); err != nil {
+				t.Fatalf("PPM.Affine: %v", err)
+			}
+			if !gotPPM.Equal(ppm) {
+				t.Error("PPM.Affine(identity) changed the image")
+			}
+			gotPPM = ppm.Clone()
+			// A homography is only defined up to scale
+			scaled := [3][3]float64{{2, 0, 0}, {0, 2, 0}, {0, 0, 2}}
+			if err := gotPPM.Perspective(scaled, opts); err != nil {
+				t.Fatalf("PPM.Perspective: %v", err)
+			}
+			if !gotPPM.Equal(ppm) {
+				t.Error("PPM.Perspective(identity) changed the image")
+			}
+		})
+	}
+}
+
+func TestWarpEdges(t *testing.T) {
+	// Moving 10 20 30 one pixel right uncovers the first column
+	shift := [2][3]float64{{1, 0, 1}, {0, 1, 0}}
+	tests := []struct {
+		name string
+		opts *WarpOptions
+		want []uint16
+	}{
+		{"default", nil, []uint16{0, 10, 20}},
+		{"EdgeConstant", &WarpOptions{Edge: EdgeConstant, Background: color.White}, []uint16{255, 10, 20}},
+		{"EdgeConstant gray", &WarpOptions{Background: color.Gray{100}}, []uint16{100, 10, 20}},
+		{"EdgeClamp", &WarpOptions{Edge: EdgeClamp, Background: color.White}, []uint16{10, 10, 20}},
+		{"EdgeWrap", &WarpOptions{Edge: EdgeWrap, Background: color.White}, []uint16{30, 10, 20}},
+		{"EdgeWrap bilinear", &WarpOptions{Edge: EdgeWrap, Filter: Bilinear}, []uint16{30, 10, 20}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pgm, _ := NewPGM(3, 1, "P2", 255)
+			copy(pgm.Pix(), []uint16{10, 20, 30})
+			if err := pgm.Affine(shift, tt.opts); err != nil {
+				t.Fatalf("Affine: %v", err)
+			}
+			if !slices.Equal(pgm.Pix(), tt.want) {
+				t.Errorf("Affine = %v, want %v", pgm.Pix(), tt.want)
+			}
+		})
+	}
+
+	ppm, _ := NewPPM(2, 1, "P3", 255)
+	ppm.SetPixel(0, 0, Pixel{1, 2, 3})
+	ppm.SetPixel(1, 0, Pixel{4, 5, 6})
+	if err := ppm.Affine(shift, &WarpOptions{Background: color.RGBA{255, 0, 0, 255}}); err != nil {
+		t.Fatal(err)
+	}
+	if want := []uint16{255, 0, 0, 1, 2, 3}; !slices.Equal(ppm.Pix(), want) {
+		t.Errorf("PPM.Affine = %v, want %v", ppm.Pix(), want)
+	}
+}
+
+func TestWarpSize(t *testing.T) {
+	pgm := patternPGM(t, 4, 3, 255)
+	want := pgm.Clone()
+	if err := pgm.Affine(identityAffine, &WarpOptions{Width: 6, Height: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if w, h := pgm.Size(); w != 6 || h != 2 {
+		t.Fatalf("size = %dx%d, want 6x2", w, h)
+	}
+	for y := 0; y < 2; y++ {
+		for x := 0; x < 6; x++ {
+			wantValue := uint16(0)
+			if x < 4 {
+				wantValue = want.GrayAt(x, y)
+			}
+			if got := pgm.GrayAt(x, y); got != wantValue {
+				t.Errorf("pixel (%d, %d) = %d, want %d", x, y, got, wantValue)
+			}
+		}
+	}
+}
+
+func TestWarpErrors(t *testing.T) {
+	pgm := patternPGM(t, 4, 4, 255)
+	ppm := patternPPM(t, 4, 4, 255)
+
+	singular := [2][3]float64{{1, 2, 0}, {2, 4, 0}}
+	if err := pgm.Affine(singular, nil); !errors.Is(err, ErrSingularMatrix) {
+		t.Errorf("PGM.Affine error = %v, want %v", err, ErrSingularMatrix)
+	}
+	if err := ppm.Affine([2][3]float64{}, nil); !errors.Is(err, ErrSingularMatrix) {
+		t.Errorf("PPM.Affine error = %v, want %v", err, ErrSingularMatrix)
+	}
+	flat := [3][3]float64{{1, 0, 0}, {0, 1, 0}, {1, 0, 0}}
+	if err := pgm.Perspective(flat, nil); !errors.Is(err, ErrSingularMatrix) {
+		t.Errorf("PGM.Perspective error = %v, want %v", err, ErrSingularMatrix)
+	}
+	if err := ppm.Perspective([3][3]float64{}, nil); !errors.Is(err, ErrSingularMatrix) {
+		t.Errorf("PPM.Perspective error = %v, want %v", err, ErrSingularMatrix)
+	}
+
+	invalid := []*WarpOptions{
+		{Filter: Lanczos + 1},
+		{Edge: EdgeWrap + 1},
+		{Width: -1},
+	}
+	for _, opts := range invalid {
+		if err := pgm.Affine(identityAffine, opts); err == nil {
+			t.Errorf("Affine with %+v succeeded", opts)
+		}
+	}
+	if want := patternPGM(t, 4, 4, 255); !pgm.Equal(want) {
+		t.Error("failed warps changed the image")
+	}
+
+	// An empty source has nothing to sample, whatever the edge mode
+	wrap := &WarpOptions{Edge: EdgeWrap, Width: 2, Height: 2}
+	if err := pgm.SubImage(image.Rectangle{}).Affine(identityAffine, wrap); err == nil {
+		t.Error("PGM.Affine of an empty image succeeded")
+	}
+	if err := pgm.SubImage(image.Rect(1, 1, 3, 1)).Perspective(identityPerspective, wrap); err == nil {
+		t.Error("PGM.Perspective of an empty image succeeded")
+	}
+	if err := ppm.SubImage(image.Rectangle{}).Affine(identityAffine, wrap); err == nil {
+		t.Error("PPM.Affine of an empty image succeeded")
+	}
+	if err := ppm.SubImage(image.Rectangle{}).Perspective(identityPerspective, wrap); err == nil {
+		t.Error("PPM.Perspective of an empty image succeeded")
+	}
+}